@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/topfreegames/helm-generate/pkg/util"
+)
+
+// defaultIgnoreFilename is the file listing, in gitignore syntax, the paths skipped
+// while looking for values files
+const defaultIgnoreFilename = ".helmgenerateignore"
+
+// discoveryOptions controls which values files are found under the root path
+type discoveryOptions struct {
+	// ValuesYaml is the name of the values files
+	ValuesYaml string
+	// IgnoreFile is the name of the ignore files honored on every folder, if not empty
+	IgnoreFile string
+	// Include and Exclude are matched against the folder of each values file, relative
+	// to the root path, and its parent folders
+	Include []*regexp.Regexp
+	Exclude []*regexp.Regexp
+	// FollowSymlinks descends into symlinked folders
+	FollowSymlinks bool
+}
+
+// newDiscoveryOptions reads the discovery flags. Commands that don't define the
+// ignore file flag still honor the default ignore file.
+func newDiscoveryOptions(cmd *cobra.Command) (discoveryOptions, error) {
+	opts := discoveryOptions{
+		ValuesYaml:     cmd.Flag(flagHelmValuesFilename).Value.String(),
+		IgnoreFile:     defaultIgnoreFilename,
+		FollowSymlinks: boolFlag(cmd, flagFollowSymlinks),
+	}
+	if flag := cmd.Flag(flagIgnoreFilename); flag != nil {
+		opts.IgnoreFile = flag.Value.String()
+	}
+	var err error
+	if opts.Include, err = compileGlobs(stringSliceFlag(cmd, flagInclude)); err != nil {
+		return opts, fmt.Errorf("invalid --%s: %w", flagInclude, err)
+	}
+	if opts.Exclude, err = compileGlobs(stringSliceFlag(cmd, flagExclude)); err != nil {
+		return opts, fmt.Errorf("invalid --%s: %w", flagExclude, err)
+	}
+	return opts, nil
+}
+
+func compileGlobs(globs []string) ([]*regexp.Regexp, error) {
+	var patterns []*regexp.Regexp
+	for _, glob := range globs {
+		pattern, err := util.CompileGlob(strings.Trim(filepath.ToSlash(glob), "/"))
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// selected tells whether the values files on dir, relative to the root path, are
+// included and not excluded
+func (o discoveryOptions) selected(dir string) bool {
+	if len(o.Include) > 0 && !matchesDir(o.Include, dir) {
+		return false
+	}
+	return !matchesDir(o.Exclude, dir)
+}
+
+// matchesDir tells whether any pattern matches dir or one of its parent folders
+func matchesDir(patterns []*regexp.Regexp, dir string) bool {
+	for ; ; dir = path.Dir(dir) {
+		for _, pattern := range patterns {
+			if pattern.MatchString(dir) {
+				return true
+			}
+		}
+		if !strings.Contains(dir, "/") {
+			return false
+		}
+	}
+}
+
+// ignoreFiles holds the rules of the ignore files found while walking, by folder
+// relative to the root path
+type ignoreFiles map[string]util.IgnoreRules
+
+// read loads the ignore file on dir, if there is one
+func (f ignoreFiles) read(rootPath string, dir string, name string) error {
+	file, err := os.Open(filepath.Join(rootPath, filepath.FromSlash(dir), name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Error reading ignore file: %w", err)
+	}
+	defer file.Close()
+	rules, err := util.ParseIgnoreRules(file)
+	if err != nil {
+		return fmt.Errorf("Error parsing ignore file %s: %w", file.Name(), err)
+	}
+	f[dir] = rules
+	return nil
+}
+
+// ignored applies the ignore files from the root path down to the parent folder of
+// rel, so the nearest ignore file has the last word
+func (f ignoreFiles) ignored(rel string, isDir bool) bool {
+	ignored := false
+	dir := "."
+	for _, segment := range strings.Split(rel, "/") {
+		if rules, ok := f[dir]; ok {
+			sub := rel
+			if dir != "." {
+				sub = strings.TrimPrefix(rel, dir+"/")
+			}
+			if i, matched := rules.Match(sub, isDir); matched {
+				ignored = i
+			}
+		}
+		dir = path.Join(dir, segment)
+	}
+	return ignored
+}
+
+// discoverValuesFiles walks rootPath and returns every values file found, in walk
+// order. .git folders, paths matched by the ignore files and folders not selected by
+// the include and exclude globs are skipped.
+func discoverValuesFiles(rootPath string, opts discoveryOptions) ([]string, error) {
+	var valuesFiles []string
+	ignores := ignoreFiles{}
+	walk := filepath.Walk
+	if opts.FollowSymlinks {
+		walk = walkFollowingSymlinks
+	}
+	err := walk(rootPath,
+		func(fullFilePath string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(rootPath, fullFilePath)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if info.IsDir() {
+				if rel != "." && (info.Name() == ".git" || ignores.ignored(rel, true)) {
+					return filepath.SkipDir
+				}
+				if opts.IgnoreFile != "" {
+					return ignores.read(rootPath, rel, opts.IgnoreFile)
+				}
+				return nil
+			}
+			if info.Name() == opts.ValuesYaml && !ignores.ignored(rel, false) && opts.selected(path.Dir(rel)) {
+				valuesFiles = append(valuesFiles, fullFilePath)
+			}
+			return nil
+		})
+	return valuesFiles, err
+}
+
+// walkFollowingSymlinks walks root in lexical order as filepath.Walk does, but also
+// descends into symlinked folders, under the path of the link. Links to a folder that
+// is being walked, which would loop forever, and dangling links are logged and skipped.
+func walkFollowingSymlinks(root string, walkFn filepath.WalkFunc) error {
+	info, err := os.Stat(root)
+	if err != nil {
+		err = walkFn(root, nil, err)
+	} else {
+		err = walkLinks(root, info, map[string]bool{}, walkFn)
+	}
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+// walkLinks walks path, whose real path is not on ancestors
+func walkLinks(path string, info os.FileInfo, ancestors map[string]bool, walkFn filepath.WalkFunc) error {
+	if !info.IsDir() {
+		return walkFn(path, info, nil)
+	}
+	realPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return walkFn(path, info, err)
+	}
+	realPath, err = filepath.Abs(realPath)
+	if err != nil {
+		return walkFn(path, info, err)
+	}
+	if ancestors[realPath] {
+		log.Printf("skipping symlink %s: it loops back to %s", path, realPath)
+		return nil
+	}
+	if err := walkFn(path, info, nil); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return walkFn(path, info, err)
+	}
+
+	ancestors[realPath] = true
+	defer delete(ancestors, realPath)
+	for _, entry := range entries {
+		child := filepath.Join(path, entry.Name())
+		childInfo, err := os.Stat(child)
+		if err != nil && entry.Type()&fs.ModeSymlink != 0 && errors.Is(err, fs.ErrNotExist) {
+			log.Printf("skipping dangling symlink %s", child)
+			continue
+		}
+		if err != nil {
+			err = walkFn(child, nil, err)
+		} else {
+			err = walkLinks(child, childInfo, ancestors, walkFn)
+		}
+		if err == filepath.SkipDir {
+			if childInfo != nil && childInfo.IsDir() {
+				continue
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// valuesFile is a values file along with the topmost folder whose .helm.yaml files it
+// inherits
+type valuesFile struct {
+	Root string
+	Path string
+}
+
+// rootPaths returns the root paths given as arguments and listed on the --from-file
+// file, or on stdin for -, one per line. Blank lines and lines starting with # are
+// skipped. Without any of them, the current folder is the root path.
+func rootPaths(cmd *cobra.Command, args []string) ([]string, error) {
+	roots := append([]string{}, args...)
+	fromFile := stringFlag(cmd, flagFromFile)
+	if fromFile == "" {
+		if len(roots) == 0 {
+			roots = append(roots, ".")
+		}
+		return roots, nil
+	}
+
+	var r io.Reader = cmd.InOrStdin()
+	if fromFile != "-" {
+		file, err := os.Open(fromFile)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading root paths: %w", err)
+		}
+		defer file.Close()
+		r = file
+	}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		roots = append(roots, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Error reading root paths: %w", err)
+	}
+	return roots, nil
+}
+
+// discoverRoots finds the values files under every root path, in order. A values file
+// found under more than one root path is only returned for the first one. The
+// .helm.yaml files are inherited from basePath, which must contain every root path,
+// or from each root path when basePath is empty.
+func discoverRoots(roots []string, basePath string, opts discoveryOptions) ([]valuesFile, error) {
+	var valuesFiles []valuesFile
+	seen := map[string]bool{}
+	for _, root := range roots {
+		inheritFrom := root
+		if basePath != "" {
+			if err := checkInside(basePath, root); err != nil {
+				return nil, err
+			}
+			inheritFrom = basePath
+		}
+		files, err := discoverValuesFiles(root, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			abs, err := filepath.Abs(file)
+			if err != nil {
+				return nil, err
+			}
+			if seen[abs] {
+				continue
+			}
+			seen[abs] = true
+			valuesFiles = append(valuesFiles, valuesFile{Root: inheritFrom, Path: file})
+		}
+	}
+	return valuesFiles, nil
+}
+
+// checkInside fails if dir is not basePath or one of its subfolders
+func checkInside(basePath string, dir string) error {
+	inside, err := isInside(basePath, dir)
+	if err != nil {
+		return err
+	}
+	if !inside {
+		return fmt.Errorf("root path %s is not inside the base path %s", dir, basePath)
+	}
+	return nil
+}
+
+// isInside tells whether dir is parent or one of its subfolders
+func isInside(parent string, dir string) (bool, error) {
+	absParent, err := filepath.Abs(parent)
+	if err != nil {
+		return false, err
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return false, err
+	}
+	rel, err := filepath.Rel(absParent, absDir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false, nil
+	}
+	return true, nil
+}
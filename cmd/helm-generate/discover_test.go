@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiscoverValuesFiles(t *testing.T) {
+	tests := []TestCase{
+		{
+			Name:   "every folder",
+			Sample: []interface{}{"tests/samples/multiple-apps", []string{}, []string{}},
+			Expected: []string{
+				"tests/samples/multiple-apps/ns1/app1/values.yaml",
+				"tests/samples/multiple-apps/ns2/app2/values.yaml",
+				"tests/samples/multiple-apps/ns2/app3/values.yaml",
+			},
+		},
+		{
+			Name:   "included parent folder",
+			Sample: []interface{}{"tests/samples/multiple-apps", []string{"ns2"}, []string{}},
+			Expected: []string{
+				"tests/samples/multiple-apps/ns2/app2/values.yaml",
+				"tests/samples/multiple-apps/ns2/app3/values.yaml",
+			},
+		},
+		{
+			Name:   "include and exclude",
+			Sample: []interface{}{"tests/samples/multiple-apps", []string{"*/app*"}, []string{"ns2/app3"}},
+			Expected: []string{
+				"tests/samples/multiple-apps/ns1/app1/values.yaml",
+				"tests/samples/multiple-apps/ns2/app2/values.yaml",
+			},
+		},
+		{
+			Name:   "ignore files",
+			Sample: []interface{}{"tests/samples/ignore-file", []string{}, []string{}},
+			Expected: []string{
+				"tests/samples/ignore-file/app/values.yaml",
+			},
+		},
+	}
+	for i, test := range tests {
+		t.Logf("Test case %d: %s", i, test.Name)
+		sample := test.Sample.([]interface{})
+		mockCmd := &cobra.Command{Use: "helm-generate [root-path]"}
+		mockCmd.Flags().StringP(flagHelmValuesFilename, "f", "values.yaml", "")
+		mockCmd.Flags().StringSlice(flagInclude, sample[1].([]string), "")
+		mockCmd.Flags().StringSlice(flagExclude, sample[2].([]string), "")
+
+		opts, err := newDiscoveryOptions(mockCmd)
+		assert.NoError(t, err, "should not return error")
+		valuesFiles, err := discoverValuesFiles(sample[0].(string), opts)
+		assert.NoError(t, err, "should not return error")
+		assert.Equal(t, test.Expected, valuesFiles, "should discover the expected values files")
+	}
+}
+
+func TestDiscoverValuesFilesWithoutIgnoreFile(t *testing.T) {
+	mockCmd := &cobra.Command{Use: "helm-generate [root-path]"}
+	mockCmd.Flags().StringP(flagHelmValuesFilename, "f", "values.yaml", "")
+	mockCmd.Flags().String(flagIgnoreFilename, "", "")
+
+	opts, err := newDiscoveryOptions(mockCmd)
+	assert.NoError(t, err, "should not return error")
+	valuesFiles, err := discoverValuesFiles("tests/samples/ignore-file", opts)
+	assert.NoError(t, err, "should not return error")
+	assert.Len(t, valuesFiles, 4, "should find every values file")
+}
+
+func TestRootPaths(t *testing.T) {
+	fromFile := filepath.Join(t.TempDir(), "roots.txt")
+	if err := os.WriteFile(fromFile, []byte("# changed apps\nns1/app1\n\n  ns2/app2  \n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []TestCase{
+		{
+			Name:     "current folder by default",
+			Sample:   []interface{}{[]string{}, "", ""},
+			Expected: []string{"."},
+		},
+		{
+			Name:     "several arguments",
+			Sample:   []interface{}{[]string{"ns1", "ns2"}, "", ""},
+			Expected: []string{"ns1", "ns2"},
+		},
+		{
+			Name:     "arguments and file",
+			Sample:   []interface{}{[]string{"ns3"}, fromFile, ""},
+			Expected: []string{"ns3", "ns1/app1", "ns2/app2"},
+		},
+		{
+			Name:     "stdin",
+			Sample:   []interface{}{[]string{}, "-", "ns1/app1\nns2/app3\n"},
+			Expected: []string{"ns1/app1", "ns2/app3"},
+		},
+		{
+			Name:     "empty stdin",
+			Sample:   []interface{}{[]string{}, "-", ""},
+			Expected: []string{},
+		},
+	}
+	for i, test := range tests {
+		t.Logf("Test case %d: %s", i, test.Name)
+		sample := test.Sample.([]interface{})
+		mockCmd := &cobra.Command{Use: "helm-generate [root-path...]"}
+		mockCmd.Flags().String(flagFromFile, sample[1].(string), "")
+		mockCmd.SetIn(strings.NewReader(sample[2].(string)))
+
+		roots, err := rootPaths(mockCmd, sample[0].([]string))
+		assert.NoError(t, err, "should not return error")
+		assert.Equal(t, test.Expected, roots, "should return the expected root paths")
+	}
+}
+
+func TestDiscoverRoots(t *testing.T) {
+	opts := discoveryOptions{ValuesYaml: "values.yaml"}
+	roots := []string{
+		"tests/samples/multiple-apps/ns2/app3",
+		"tests/samples/multiple-apps",
+		"tests/samples/multiple-apps/ns1",
+	}
+
+	valuesFiles, err := discoverRoots(roots, "", opts)
+	assert.NoError(t, err, "should not return error")
+	assert.Equal(t, []valuesFile{
+		{Root: "tests/samples/multiple-apps/ns2/app3", Path: "tests/samples/multiple-apps/ns2/app3/values.yaml"},
+		{Root: "tests/samples/multiple-apps", Path: "tests/samples/multiple-apps/ns1/app1/values.yaml"},
+		{Root: "tests/samples/multiple-apps", Path: "tests/samples/multiple-apps/ns2/app2/values.yaml"},
+	}, valuesFiles, "should find each values file once, under the first root path")
+
+	valuesFiles, err = discoverRoots(roots[2:], "tests/samples", opts)
+	assert.NoError(t, err, "should not return error")
+	assert.Equal(t, []valuesFile{
+		{Root: "tests/samples", Path: "tests/samples/multiple-apps/ns1/app1/values.yaml"},
+	}, valuesFiles, "should inherit from the base path")
+
+	_, err = discoverRoots(roots, "tests/samples/multiple-apps/ns1", opts)
+	assert.Error(t, err, "should fail for root paths outside the base path")
+}
+
+func TestDiscoverValuesFilesFollowSymlinks(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"base/app", "overlays/prod"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, "base/app/values.yaml"), []byte("releaseName: app\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	links := map[string]string{
+		"overlays/prod/app":     "../../base/app",
+		"overlays/prod/loop":    "..",
+		"overlays/prod/missing": "../../base/missing",
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	tests := []TestCase{
+		{
+			Name:   "symlinks are not followed by default",
+			Sample: false,
+			Expected: []string{
+				filepath.Join(root, "base/app/values.yaml"),
+			},
+		},
+		{
+			Name:   "symlinked folders are followed",
+			Sample: true,
+			Expected: []string{
+				filepath.Join(root, "base/app/values.yaml"),
+				filepath.Join(root, "overlays/prod/app/values.yaml"),
+			},
+		},
+	}
+	for i, test := range tests {
+		t.Logf("Test case %d: %s", i, test.Name)
+		opts := discoveryOptions{ValuesYaml: "values.yaml", FollowSymlinks: test.Sample.(bool)}
+		valuesFiles, err := discoverValuesFiles(root, opts)
+		assert.NoError(t, err, "should not return error")
+		assert.Equal(t, test.Expected, valuesFiles, "should discover the expected values files")
+	}
+	assert.Contains(t, logs.String(), "skipping symlink "+filepath.Join(root, "overlays/prod/loop"), "should warn about the cycle")
+	assert.Contains(t, logs.String(), "skipping dangling symlink "+filepath.Join(root, "overlays/prod/missing"), "should warn about the dangling symlink")
+
+	_, err := discoverValuesFiles(filepath.Join(root, "overlays/prod/missing"), discoveryOptions{ValuesYaml: "values.yaml", FollowSymlinks: true})
+	assert.Error(t, err, "should fail when the root path is a dangling symlink")
+}
@@ -2,11 +2,13 @@ package main
 
 import (
 	"bytes"
-	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
@@ -16,31 +18,39 @@ import (
 	"github.com/topfreegames/helm-generate/pkg/helm"
 	"github.com/topfreegames/helm-generate/pkg/util"
 
-	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/releaseutil"
 )
 
-func getManifestsForPath(fullFilePath string, h *helm.Configuration) ([]map[string]interface{}, error) {
+func getManifestsForPath(rootPath string, fullFilePath string, h *helm.Configuration) ([]util.Resource, error) {
 	path, filename := filepath.Split(fullFilePath)
 	// Stores default configuration
-	var manifests []map[string]interface{}
+	var resources []util.Resource
 	if filename == h.ValuesYaml {
-		helmYamlFullPath := path + h.HelmYaml
-		file, _ := os.Open(helmYamlFullPath)
-		defer file.Close()
-		_ = h.BuildHelmConfig(file)
-		vals, err := chartutil.ReadValuesFile(fullFilePath)
+		if err := h.BuildHelmConfigFromPath(rootPath, path); err != nil {
+			return resources, err
+		}
+		vals, err := h.ReadValues(fullFilePath)
 		if err != nil {
-			return manifests, fmt.Errorf("Read Values: %v", err)
+			return resources, fmt.Errorf("Read Values: %v", err)
 		}
-		for k, v := range h.KeyValueAssignments {
-			vals[k] = v
+		manifests, err := h.InstallChart(vals)
+		if err != nil {
+			return resources, fmt.Errorf("Error generating manifests for chart %v: %v", h.Chart, err)
 		}
-		manifests, err = h.InstallChart(vals)
+		releaseName, namespace, err := h.ReleaseIdentity(vals)
 		if err != nil {
-			return manifests, fmt.Errorf("Error generating manifests for chart %v: %v", h.Chart, err)
+			return resources, err
+		}
+		for _, manifest := range manifests {
+			resources = append(resources, util.Resource{
+				Manifest:  manifest,
+				Source:    filepath.Dir(fullFilePath),
+				Release:   releaseName,
+				Namespace: namespace,
+			})
 		}
 	}
-	return manifests, nil
+	return resources, nil
 }
 
 func yamlEncoder(encoder *yaml.Encoder) func(element map[string]interface{}) {
@@ -50,70 +60,291 @@ func yamlEncoder(encoder *yaml.Encoder) func(element map[string]interface{}) {
 	}
 }
 
-func helmGenerate(cmd *cobra.Command, args []string) (bytes.Buffer, error) {
-	var manifests []map[string]interface{}
-	var rootPath string
-	if len(args) > 0 {
-		rootPath = args[0]
-	} else {
-		rootPath = "."
+// renderError describes the failure to render a single values file
+type renderError struct {
+	ValuesFile   string
+	Chart        string
+	ChartVersion string
+	Err          error
+}
+
+func (e *renderError) Error() string {
+	return fmt.Sprintf("%s (chart %q, version %q): %v", e.ValuesFile, e.Chart, e.ChartVersion, e.Err)
+}
+
+func (e *renderError) Unwrap() error {
+	return e.Err
+}
+
+// renderErrors aggregates every failure of a run that kept going after the first error
+type renderErrors []*renderError
+
+func (e renderErrors) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d values file(s) failed to render:", len(e))
+	for _, err := range e {
+		fmt.Fprintf(&b, "\n  - %s", err)
 	}
+	return b.String()
+}
 
-	var keyValueAssignmentMap map[string]string
-	if flag := cmd.Flag(flagSetKeyValue); flag != nil {
-		if sliceValue, ok := flag.Value.(pflag.SliceValue); ok && sliceValue != nil {
-			m, err := parseKeyValueAssignments(sliceValue.GetSlice())
-			if err != nil {
-				return bytes.Buffer{}, fmt.Errorf("error parsing key-value assignments: %w", err)
-			}
-			keyValueAssignmentMap = m
-		}
+// renderOptions controls how the discovered values files are rendered
+type renderOptions struct {
+	// Concurrency is the number of values files rendered in parallel
+	Concurrency int
+	// KeepGoing renders every values file even if some of them fail
+	KeepGoing bool
+}
+
+// renderValuesFiles renders the given values files using up to opts.Concurrency workers. The resources are returned in the same order as
+// valuesFiles, regardless of the order in which the workers finish. Unless opts.KeepGoing is set, the error of the
+// first failing file is returned, otherwise every failure is reported as renderErrors.
+func renderValuesFiles(valuesFiles []valuesFile, opts renderOptions, newConfig func() *helm.Configuration) ([]util.Resource, error) {
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
 	}
+	results := make([][]util.Resource, len(valuesFiles))
+	errs := make([]*renderError, len(valuesFiles))
 
-	err := filepath.Walk(rootPath,
-		func(fullFilePath string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
-			config := &helm.Configuration{
-				Chart:               cmd.Flag(flagDefaultChart).Value.String(),
-				ChartVersion:        cmd.Flag(flagDefaultChartVersion).Value.String(),
-				HelmYaml:            cmd.Flag(flagHelmYamlFilename).Value.String(),
-				ValuesYaml:          cmd.Flag(flagHelmValuesFilename).Value.String(),
-				PostRenderBinary:    cmd.Flag(flagPostRenderBinary).Value.String(),
-				KeyValueAssignments: keyValueAssignmentMap,
+	// Index of the first values file that failed to render. Files after it are
+	// skipped, files before it still render, so the reported error is deterministic.
+	firstFailed := int64(len(valuesFiles))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				// Stop rendering after a failure, the result is discarded anyway
+				if !opts.KeepGoing && int64(i) > atomic.LoadInt64(&firstFailed) {
+					continue
+				}
+				config := newConfig()
+				resources, err := getManifestsForPath(valuesFiles[i].Root, valuesFiles[i].Path, config)
+				if err != nil {
+					errs[i] = &renderError{
+						ValuesFile:   valuesFiles[i].Path,
+						Chart:        config.Chart,
+						ChartVersion: config.ChartVersion,
+						Err:          err,
+					}
+					for {
+						failed := atomic.LoadInt64(&firstFailed)
+						if int64(i) >= failed || atomic.CompareAndSwapInt64(&firstFailed, failed, int64(i)) {
+							break
+						}
+					}
+					continue
+				}
+				results[i] = resources
 			}
-			chartManifests, err := getManifestsForPath(fullFilePath, config)
-			if err != nil {
-				return err
+		}()
+	}
+	for i := range valuesFiles {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	var resources []util.Resource
+	var failures renderErrors
+	for i := range valuesFiles {
+		if errs[i] != nil {
+			if !opts.KeepGoing {
+				return nil, errs[i]
 			}
-			manifests = append(manifests, chartManifests...)
-			return nil
-		})
+			failures = append(failures, errs[i])
+			continue
+		}
+		resources = append(resources, results[i]...)
+	}
+	if len(failures) > 0 {
+		return nil, failures
+	}
+	return resources, nil
+}
+
+// stringFlag returns the value of a flag, or an empty string if the command doesn't define it
+func stringFlag(cmd *cobra.Command, name string) string {
+	if flag := cmd.Flag(name); flag != nil {
+		return flag.Value.String()
+	}
+	return ""
+}
+
+// boolFlag returns the value of a boolean flag, or false if the command doesn't define it
+func boolFlag(cmd *cobra.Command, name string) bool {
+	if flag := cmd.Flag(name); flag != nil {
+		value, _ := strconv.ParseBool(flag.Value.String())
+		return value
+	}
+	return false
+}
+
+func helmGenerate(cmd *cobra.Command, args []string) (bytes.Buffer, error) {
+	roots, err := rootPaths(cmd, args)
 	if err != nil {
 		return bytes.Buffer{}, err
 	}
+	basePath := stringFlag(cmd, flagBasePath)
 
-	var buf bytes.Buffer
-	enc := yaml.NewEncoder(&buf)
-	util.WalkDedup(manifests, yamlEncoder(enc))
+	keyValueAssignments, err := parseKeyValueAssignments(cmd)
+	if err != nil {
+		return bytes.Buffer{}, fmt.Errorf("error parsing key-value assignments: %w", err)
+	}
+
+	concurrency := 1
+	if flag := cmd.Flag(flagConcurrency); flag != nil {
+		n, err := strconv.Atoi(flag.Value.String())
+		if err != nil {
+			return bytes.Buffer{}, fmt.Errorf("invalid concurrency: %w", err)
+		}
+		concurrency = n
+	}
 
+	outputFormat := stringFlag(cmd, flagOutputFormat)
+	if _, err := outputExtension(outputFormat); err != nil {
+		return bytes.Buffer{}, err
+	}
+
+	outputDir := stringFlag(cmd, flagOutputDir)
+	if outputDir != "" {
+		if err := checkOutputDir(outputDir, roots); err != nil {
+			return bytes.Buffer{}, err
+		}
+	}
+
+	discovery, err := newDiscoveryOptions(cmd)
+	if err != nil {
+		return bytes.Buffer{}, err
+	}
+	valuesFiles, err := discoverRoots(roots, basePath, discovery)
+	if err != nil {
+		return bytes.Buffer{}, err
+	}
+
+	opts := renderOptions{
+		Concurrency: concurrency,
+		KeepGoing:   boolFlag(cmd, flagKeepGoing),
+	}
+	var lock *helm.Lock
+	if boolFlag(cmd, flagLocked) && len(valuesFiles) > 0 {
+		lockFile, err := lockFilePath(cmd, roots, basePath)
+		if err != nil {
+			return bytes.Buffer{}, err
+		}
+		lock, err = helm.ReadLock(lockFile)
+		if err != nil {
+			return bytes.Buffer{}, err
+		}
+	}
+
+	chartCache := helm.NewChartCache(stringFlag(cmd, flagChartCacheDir))
+	resources, err := renderValuesFiles(valuesFiles, opts, func() *helm.Configuration {
+		config := newConfig(cmd, keyValueAssignments)
+		config.ChartCache = chartCache
+		config.Lock = lock
+		return config
+	})
+	if err != nil {
+		return bytes.Buffer{}, err
+	}
+
+	resources, err = util.DedupResources(resources)
+	if err != nil {
+		return bytes.Buffer{}, err
+	}
+
+	if boolFlag(cmd, flagSort) {
+		util.SortResources(resources, releaseutil.InstallOrder)
+	}
+
+	if outputDir != "" {
+		return bytes.Buffer{}, writeOutputDir(outputDir, stringFlag(cmd, flagOutputLayout), outputFormat, resources)
+	}
+
+	var manifests []map[string]interface{}
+	for _, resource := range resources {
+		manifests = append(manifests, resource.Manifest)
+	}
+	var buf bytes.Buffer
+	if err := encodeManifests(&buf, outputFormat, manifests); err != nil {
+		return bytes.Buffer{}, err
+	}
 	return buf, nil
 }
 
-func parseKeyValueAssignments(keyValueAssignments []string) (map[string]string, error) {
-	m := make(map[string]string)
-	for _, keyValue := range keyValueAssignments {
-		s := strings.Split(keyValue, "=")
-		if len(s) != 2 {
-			return nil, fmt.Errorf("key-value assignment string is not of the form <key>=<value>: %s", keyValue)
+// newConfig builds the configuration set by flags, before applying any .helm.yaml. The
+// sources of the default chart, version and post-renderer are recorded.
+func newConfig(cmd *cobra.Command, keyValueAssignments *helm.KeyValueAssignments) *helm.Configuration {
+	config := &helm.Configuration{
+		Chart:               cmd.Flag(flagDefaultChart).Value.String(),
+		ChartVersion:        cmd.Flag(flagDefaultChartVersion).Value.String(),
+		HelmYaml:            cmd.Flag(flagHelmYamlFilename).Value.String(),
+		ValuesYaml:          cmd.Flag(flagHelmValuesFilename).Value.String(),
+		PostRenderBinary:    stringFlag(cmd, flagPostRenderBinary),
+		ClusterScopedKinds:  stringSliceFlag(cmd, flagClusterScopedKinds),
+		APIResourcesFile:    stringFlag(cmd, flagAPIResourcesFile),
+		Offline:             boolFlag(cmd, flagOffline),
+		KubeVersion:         stringFlag(cmd, flagKubeVersion),
+		APIVersions:         stringSliceFlag(cmd, flagAPIVersions),
+		APIVersionsFile:     stringFlag(cmd, flagAPIVersionsFile),
+		DependencyUpdate:    boolFlag(cmd, flagDependencyUpdate),
+		Verify:              boolFlag(cmd, flagVerify),
+		Keyring:             stringFlag(cmd, flagKeyring),
+		ReleaseNameKey:      stringFlag(cmd, flagReleaseNameKey),
+		NamespaceKey:        stringFlag(cmd, flagNamespaceKey),
+		KeyValueAssignments: keyValueAssignments,
+		Strict:              boolFlag(cmd, flagStrict),
+	}
+	sources := map[string]string{
+		"chart":            flagSource(cmd, flagDefaultChart, "HELM_DEFAULT_CHART"),
+		"chartVersion":     flagSource(cmd, flagDefaultChartVersion, "HELM_DEFAULT_CHART_VERSION"),
+		"postRenderBinary": flagSource(cmd, flagPostRenderBinary, ""),
+	}
+	for key, source := range sources {
+		if source != "" {
+			config.SetSource(key, source)
 		}
-		key := s[0]
-		value := s[1]
-		if key == "" {
-			return nil, errors.New("key-value assignment string cannot have empty key")
+	}
+	return config
+}
+
+// flagSource tells whether a flag was set on the command line or through env, if its
+// default value comes from that environment variable
+func flagSource(cmd *cobra.Command, name string, env string) string {
+	if flag := cmd.Flag(name); flag != nil && flag.Changed {
+		return "--" + name
+	}
+	if env != "" && os.Getenv(env) != "" {
+		return "$" + env
+	}
+	return ""
+}
+
+// parseKeyValueAssignments gathers the --set, --set-string, --set-file and --set-json
+// flags and validates their syntax
+func parseKeyValueAssignments(cmd *cobra.Command) (*helm.KeyValueAssignments, error) {
+	assignments := &helm.KeyValueAssignments{
+		JSONValues:   stringSliceFlag(cmd, flagSetJSON),
+		Values:       stringSliceFlag(cmd, flagSetKeyValue),
+		StringValues: stringSliceFlag(cmd, flagSetString),
+		FileValues:   stringSliceFlag(cmd, flagSetFile),
+	}
+	if err := assignments.Validate(); err != nil {
+		return nil, err
+	}
+	return assignments, nil
+}
+
+// stringSliceFlag returns the values of a slice flag, or nil if the command doesn't define it
+func stringSliceFlag(cmd *cobra.Command, name string) []string {
+	if flag := cmd.Flag(name); flag != nil {
+		if sliceValue, ok := flag.Value.(pflag.SliceValue); ok && sliceValue != nil {
+			return sliceValue.GetSlice()
 		}
-		m[key] = value
 	}
-	return m, nil
+	return nil
 }
@@ -5,10 +5,12 @@ import (
 	"fmt"
         "io"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
 )
 
 type TestCase struct {
@@ -62,6 +64,7 @@ func TestInstallChartWithArgs(t *testing.T) {
 		mockCmd.Flags().StringP(flagHelmValuesFilename, "f", "values.yaml", "")
 		mockCmd.Flags().StringP(flagPostRenderBinary, "p", "", "")
 		mockCmd.Flags().StringArray(flagSetKeyValue, []string{"cluster=cluster-name"}, "")
+		mockCmd.Flags().Int(flagConcurrency, 4, "")
 
 		b, testError := helmGenerate(mockCmd, []string{test.Sample.(string)})
 		cmdOutput, err := io.ReadAll(&b)
@@ -209,3 +212,137 @@ func TestInstallEmptyPath(t *testing.T) {
 		assert.Equal(t, test.Expected.(bytes.Buffer), b, "Empty dir should generate an empty output")
 	}
 }
+
+func TestInstallChartConcurrency(t *testing.T) {
+	sampleDir := "tests/samples/multiple-apps"
+	var outputs []string
+	for _, concurrency := range []int{1, 2, 8} {
+		t.Logf("Rendering %s with concurrency %d", sampleDir, concurrency)
+		var mockCmd = &cobra.Command{
+			Use:  "helm-generate [root-path]",
+			Args: cobra.RangeArgs(0, 1),
+		}
+		mockCmd.PersistentFlags().String(flagDefaultChart, "tests/chart", "")
+		mockCmd.PersistentFlags().String(flagDefaultChartVersion, "1.0.0", "")
+		mockCmd.Flags().String(flagHelmYamlFilename, ".helm.yaml", "")
+		mockCmd.Flags().StringP(flagHelmValuesFilename, "f", "values.yaml", "")
+		mockCmd.Flags().StringP(flagPostRenderBinary, "p", "", "")
+		mockCmd.Flags().StringArray(flagSetKeyValue, []string{"cluster=cluster-name"}, "")
+		mockCmd.Flags().Int(flagConcurrency, concurrency, "")
+
+		b, err := helmGenerate(mockCmd, []string{sampleDir})
+		assert.NoError(t, err, "should not return error for concurrency %d", concurrency)
+		outputs = append(outputs, b.String())
+	}
+	for i := range outputs {
+		assert.Equal(t, outputs[0], outputs[i], "output should not depend on the concurrency")
+	}
+}
+
+func TestInstallChartKeepGoing(t *testing.T) {
+	sampleDir := "tests/samples"
+	for _, keepGoing := range []bool{false, true} {
+		t.Logf("Rendering %s with keep-going %t", sampleDir, keepGoing)
+		var mockCmd = &cobra.Command{
+			Use:  "helm-generate [root-path]",
+			Args: cobra.RangeArgs(0, 1),
+		}
+		mockCmd.PersistentFlags().String(flagDefaultChart, "tests/chart", "")
+		mockCmd.PersistentFlags().String(flagDefaultChartVersion, "1.0.0", "")
+		mockCmd.Flags().String(flagHelmYamlFilename, ".helm.yaml", "")
+		mockCmd.Flags().StringP(flagHelmValuesFilename, "f", "values.yaml", "")
+		mockCmd.Flags().StringP(flagPostRenderBinary, "p", "", "")
+		mockCmd.Flags().StringArray(flagSetKeyValue, []string{"cluster=cluster-name"}, "")
+		mockCmd.Flags().Int(flagConcurrency, 4, "")
+		mockCmd.Flags().Bool(flagKeepGoing, keepGoing, "")
+
+		_, err := helmGenerate(mockCmd, []string{sampleDir})
+		assert.Error(t, err, "should return error when some folders fail")
+		if keepGoing {
+			failures, ok := err.(renderErrors)
+			assert.True(t, ok, "should report every failure")
+			var failed []string
+			for _, failure := range failures {
+				failed = append(failed, failure.ValuesFile)
+			}
+			assert.Equal(t, []string{
+				"tests/samples/invalid-chart/values.yaml",
+				"tests/samples/invalid-yaml/values.yaml",
+				"tests/samples/missing-required-fields/values.yaml",
+			}, failed, "should report failures in walk order")
+			assert.Equal(t, "tests/nonexistent-chart", failures[0].Chart, "should report the chart of the failing folder")
+		} else {
+			failure, ok := err.(*renderError)
+			assert.True(t, ok, "should report the first failure")
+			assert.Equal(t, "tests/samples/invalid-chart/values.yaml", failure.ValuesFile)
+		}
+	}
+}
+
+func TestInstallChartMultipleRoots(t *testing.T) {
+	var mockCmd = &cobra.Command{
+		Use:  "helm-generate [root-path...]",
+		Args: cobra.ArbitraryArgs,
+	}
+	mockCmd.PersistentFlags().String(flagDefaultChart, "tests/chart", "")
+	mockCmd.PersistentFlags().String(flagDefaultChartVersion, "1.0.0", "")
+	mockCmd.Flags().String(flagHelmYamlFilename, ".helm.yaml", "")
+	mockCmd.Flags().StringP(flagHelmValuesFilename, "f", "values.yaml", "")
+	mockCmd.Flags().StringP(flagPostRenderBinary, "p", "", "")
+	mockCmd.Flags().StringArray(flagSetKeyValue, []string{"cluster=cluster-name"}, "")
+	mockCmd.Flags().String(flagFromFile, "-", "")
+	mockCmd.Flags().String(flagBasePath, "tests/samples/multiple-apps", "")
+	mockCmd.SetIn(strings.NewReader("tests/samples/multiple-apps/ns2\ntests/samples/multiple-apps/ns2/app3\n"))
+
+	b, err := helmGenerate(mockCmd, []string{"tests/samples/multiple-apps/ns1/app1"})
+	assert.NoError(t, err, "should not return error")
+	expected, err := os.ReadFile("tests/expected/multiple-apps/output.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, string(expected), b.String(), "should render every root path once, inheriting from the base path")
+}
+
+func TestInstallChartSorted(t *testing.T) {
+	var mockCmd = &cobra.Command{
+		Use:  "helm-generate [root-path]",
+		Args: cobra.RangeArgs(0, 1),
+	}
+	mockCmd.PersistentFlags().String(flagDefaultChart, "tests/chart", "")
+	mockCmd.PersistentFlags().String(flagDefaultChartVersion, "1.0.0", "")
+	mockCmd.Flags().String(flagHelmYamlFilename, ".helm.yaml", "")
+	mockCmd.Flags().StringP(flagHelmValuesFilename, "f", "values.yaml", "")
+	mockCmd.Flags().StringP(flagPostRenderBinary, "p", "", "")
+	mockCmd.Flags().StringArray(flagSetKeyValue, []string{"cluster=cluster-name"}, "")
+	mockCmd.Flags().Bool(flagSort, true, "")
+
+	b, err := helmGenerate(mockCmd, []string{"tests/samples/multiple-apps"})
+	assert.NoError(t, err, "should not return error")
+
+	var identities []string
+	dec := yaml.NewDecoder(&b)
+	for {
+		var manifest struct {
+			Kind     string `yaml:"kind"`
+			Metadata struct {
+				Name      string `yaml:"name"`
+				Namespace string `yaml:"namespace"`
+			} `yaml:"metadata"`
+		}
+		if err := dec.Decode(&manifest); err != nil {
+			break
+		}
+		identities = append(identities, fmt.Sprintf("%s %s/%s", manifest.Kind, manifest.Metadata.Namespace, manifest.Metadata.Name))
+	}
+	assert.Equal(t, []string{
+		"Namespace /ns1",
+		"Namespace /ns2",
+		"Service ns1/my-awesome-web-application",
+		"Service ns2/app3-redis",
+		"Deployment ns1/my-awesome-web-application",
+		"Deployment ns2/app3-redis",
+		"CronJob ns2/app2-hello-env-var",
+		"CronJob ns2/app2-hello-ubuntu",
+		"CronJob ns2/app2-hello-world",
+	}, identities, "should sort manifests in install order")
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/topfreegames/helm-generate/pkg/helm"
+)
+
+const (
+	listFormatTable = "table"
+	listFormatJSON  = "json"
+)
+
+// listCmd prints what would be rendered for each values file, without rendering it
+var listCmd = &cobra.Command{
+	Use:   "list [root-path...]",
+	Short: "lists the values files that would be rendered and their resolved configuration",
+	Long:  ``,
+	Args:  cobra.ArbitraryArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := helmList(cmd, args, os.Stdout); err != nil {
+			log.Fatalf("Error listing values files: %s", err)
+		}
+	},
+}
+
+func init() {
+	listCmd.Flags().String(flagOutputFormat, listFormatTable, "Format of the list: 'table' or 'json'")
+}
+
+// listEntry is the resolved configuration of a values file
+type listEntry struct {
+	ValuesFile       string            `json:"valuesFile"`
+	Chart            string            `json:"chart"`
+	Repository       string            `json:"repository,omitempty"`
+	ChartVersion     string            `json:"chartVersion"`
+	ReleaseName      string            `json:"releaseName"`
+	Namespace        string            `json:"namespace"`
+	PostRenderBinary string            `json:"postRenderBinary,omitempty"`
+	Sources          map[string]string `json:"sources"`
+	Error            string            `json:"error,omitempty"`
+}
+
+// helmList discovers the values files with the same rules as helmGenerate and writes,
+// for each one, the chart, release and post-renderer it would be rendered with and
+// where they were configured. Values files whose configuration can't be resolved are
+// listed with their error, and make it fail once the whole list is written.
+func helmList(cmd *cobra.Command, args []string, w io.Writer) error {
+	format := stringFlag(cmd, flagOutputFormat)
+	if format != listFormatTable && format != listFormatJSON {
+		return fmt.Errorf("invalid output format %q, must be one of: %s, %s", format, listFormatTable, listFormatJSON)
+	}
+	roots, err := rootPaths(cmd, args)
+	if err != nil {
+		return err
+	}
+	keyValueAssignments, err := parseKeyValueAssignments(cmd)
+	if err != nil {
+		return fmt.Errorf("error parsing key-value assignments: %w", err)
+	}
+	discovery, err := newDiscoveryOptions(cmd)
+	if err != nil {
+		return err
+	}
+	valuesFiles, err := discoverRoots(roots, stringFlag(cmd, flagBasePath), discovery)
+	if err != nil {
+		return err
+	}
+
+	entries := []listEntry{}
+	failed := 0
+	for _, file := range valuesFiles {
+		entry := listValuesFile(newConfig(cmd, keyValueAssignments), file)
+		if entry.Error != "" {
+			failed++
+		}
+		entries = append(entries, entry)
+	}
+
+	if format == listFormatJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(entries)
+	} else {
+		err = writeListTable(w, entries)
+	}
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d values file(s) failed", failed)
+	}
+	return nil
+}
+
+// listValuesFile resolves the configuration of a values file. The release is resolved
+// even if the chart configuration is incomplete, to list as much as possible.
+func listValuesFile(config *helm.Configuration, file valuesFile) listEntry {
+	entry := listEntry{ValuesFile: file.Path}
+	configErr := config.BuildHelmConfigFromPath(file.Root, filepath.Dir(file.Path))
+	vals, err := config.ReadValues(file.Path)
+	if err == nil {
+		entry.ReleaseName, entry.Namespace, err = config.ReleaseIdentity(vals)
+	}
+	if configErr != nil {
+		err = configErr
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	entry.Chart = config.Chart
+	entry.Repository = config.Repository
+	entry.ChartVersion = config.ChartVersion
+	entry.PostRenderBinary = config.PostRenderBinary
+	entry.Sources = config.Sources
+	if entry.Sources == nil {
+		entry.Sources = map[string]string{}
+	}
+	return entry
+}
+
+// writeListTable writes the entries as a table, with the source of the chart
+func writeListTable(w io.Writer, entries []listEntry) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "VALUES FILE\tCHART\tVERSION\tRELEASE\tNAMESPACE\tPOST-RENDERER\tSOURCE\tERROR")
+	for _, entry := range entries {
+		chart := entry.Chart
+		if entry.Repository != "" {
+			chart = entry.Repository + " " + chart
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			entry.ValuesFile,
+			orDash(chart),
+			orDash(entry.ChartVersion),
+			orDash(entry.ReleaseName),
+			orDash(entry.Namespace),
+			orDash(entry.PostRenderBinary),
+			orDash(entry.Sources["chart"]),
+			orDash(entry.Error),
+		)
+	}
+	return table.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func newListCmd(format string) *cobra.Command {
+	mockCmd := &cobra.Command{
+		Use:  "list [root-path...]",
+		Args: cobra.ArbitraryArgs,
+	}
+	mockCmd.PersistentFlags().String(flagDefaultChart, "tests/chart", "")
+	mockCmd.PersistentFlags().String(flagDefaultChartVersion, "1.0.0", "")
+	mockCmd.Flags().String(flagHelmYamlFilename, ".helm.yaml", "")
+	mockCmd.Flags().StringP(flagHelmValuesFilename, "f", "values.yaml", "")
+	mockCmd.Flags().StringP(flagPostRenderBinary, "p", "", "")
+	mockCmd.Flags().StringArray(flagSetKeyValue, []string{}, "")
+	mockCmd.Flags().String(flagOutputFormat, format, "")
+	return mockCmd
+}
+
+func TestList(t *testing.T) {
+	mockCmd := newListCmd(listFormatJSON)
+	if err := mockCmd.ParseFlags([]string{"--default-chart", "tests/chart", "--set", "namespace=from-set"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	err := helmList(mockCmd, []string{"tests/samples/multiple-apps", "tests/samples/release-identity"}, &b)
+	assert.NoError(t, err, "should not return error")
+	var entries []listEntry
+	assert.NoError(t, json.Unmarshal(b.Bytes(), &entries), "should print JSON")
+	assert.Equal(t, []listEntry{
+		{
+			ValuesFile:   "tests/samples/multiple-apps/ns1/app1/values.yaml",
+			Chart:        "tests/chart",
+			ChartVersion: "1.0.0",
+			ReleaseName:  "app1",
+			Namespace:    "from-set",
+			Sources:      map[string]string{"chart": "--default-chart", "releaseName": "values file", "namespace": "--set"},
+		},
+		{
+			ValuesFile:   "tests/samples/multiple-apps/ns2/app2/values.yaml",
+			Chart:        "tests/cronjob-chart",
+			ChartVersion: "1.0.0",
+			ReleaseName:  "app2",
+			Namespace:    "from-set",
+			Sources: map[string]string{
+				"chart":        "tests/samples/multiple-apps/ns2/app2/.helm.yaml",
+				"chartVersion": "tests/samples/multiple-apps/ns2/app2/.helm.yaml",
+				"releaseName":  "values file",
+				"namespace":    "--set",
+			},
+		},
+		{
+			ValuesFile:   "tests/samples/multiple-apps/ns2/app3/values.yaml",
+			Chart:        "tests/chart",
+			ChartVersion: "1.0.0",
+			ReleaseName:  "app3",
+			Namespace:    "from-set",
+			Sources:      map[string]string{"chart": "--default-chart", "releaseName": "values file", "namespace": "--set"},
+		},
+		{
+			ValuesFile:   "tests/samples/release-identity/values.yaml",
+			Chart:        "tests/chart",
+			ChartVersion: "1.0.0",
+			ReleaseName:  "release-identity",
+			Namespace:    "team-a",
+			Sources: map[string]string{
+				"chart":        "--default-chart",
+				"namespaceKey": "tests/samples/release-identity/.helm.yaml",
+				"releaseName":  "folder name",
+				"namespace":    "values file",
+			},
+		},
+		{
+			ValuesFile:   "tests/samples/release-identity/worker/values.yaml",
+			Chart:        "tests/chart",
+			ChartVersion: "1.0.0",
+			ReleaseName:  "background-worker",
+			Namespace:    "team-b",
+			Sources: map[string]string{
+				"chart":        "--default-chart",
+				"namespaceKey": "tests/samples/release-identity/.helm.yaml",
+				"releaseName":  "tests/samples/release-identity/worker/.helm.yaml",
+				"namespace":    "tests/samples/release-identity/worker/.helm.yaml",
+			},
+		},
+	}, entries, "should list the resolved configuration of every values file")
+}
+
+func TestListTable(t *testing.T) {
+	var b bytes.Buffer
+	err := helmList(newListCmd(listFormatTable), []string{"tests/samples/missing-required-fields", "tests/samples/single-app"}, &b)
+	assert.Error(t, err, "should fail if a values file can't be resolved")
+
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	assert.Len(t, lines, 3, "should list every values file after the header")
+	assert.Equal(t, []string{"VALUES", "FILE", "CHART", "VERSION", "RELEASE", "NAMESPACE", "POST-RENDERER", "SOURCE", "ERROR"}, strings.Fields(lines[0]))
+	assert.Contains(t, lines[1], "Missing required field [namespace]", "should list the error")
+	assert.Equal(t, []string{"tests/samples/single-app/values.yaml", "tests/chart", "1.0.0", "app", "ns", "-", "-", "-"}, strings.Fields(lines[2]))
+
+	err = helmList(newListCmd("yaml"), []string{"tests/samples/single-app"}, &b)
+	assert.Error(t, err, "should fail on unknown formats")
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/topfreegames/helm-generate/pkg/helm"
+)
+
+// lockCmd writes the lock file pinning the charts used on a folder
+var lockCmd = &cobra.Command{
+	Use:   "lock [root-path...]",
+	Short: "pins the charts used on a folder to exact versions and digests",
+	Long:  ``,
+	Args:  cobra.ArbitraryArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := helmLock(cmd, args); err != nil {
+			log.Fatalf("Error locking charts: %s", err)
+		}
+	},
+}
+
+// lockFilePath returns the lock file set by flag, or the default one on the base path
+// or, without a base path, on the only root path
+func lockFilePath(cmd *cobra.Command, roots []string, basePath string) (string, error) {
+	if path := stringFlag(cmd, flagLockFile); path != "" {
+		return path, nil
+	}
+	if basePath != "" {
+		return filepath.Join(basePath, helm.LockFileName), nil
+	}
+	if len(roots) != 1 {
+		return "", fmt.Errorf("--%s or --%s must be set with %d root paths", flagLockFile, flagBasePath, len(roots))
+	}
+	return filepath.Join(roots[0], helm.LockFileName), nil
+}
+
+// helmLock resolves every chart reference and version constraint used on the root
+// paths, once each, and writes them to the lock file
+func helmLock(cmd *cobra.Command, args []string) error {
+	roots, err := rootPaths(cmd, args)
+	if err != nil {
+		return err
+	}
+	basePath := stringFlag(cmd, flagBasePath)
+	lockFile, err := lockFilePath(cmd, roots, basePath)
+	if err != nil {
+		return err
+	}
+
+	valuesYaml := cmd.Flag(flagHelmValuesFilename).Value.String()
+	discovery, err := newDiscoveryOptions(cmd)
+	if err != nil {
+		return err
+	}
+	valuesFiles, err := discoverRoots(roots, basePath, discovery)
+	if err != nil {
+		return err
+	}
+
+	lock := &helm.Lock{}
+	for _, file := range valuesFiles {
+		config := &helm.Configuration{
+			Chart:            cmd.Flag(flagDefaultChart).Value.String(),
+			ChartVersion:     cmd.Flag(flagDefaultChartVersion).Value.String(),
+			HelmYaml:         cmd.Flag(flagHelmYamlFilename).Value.String(),
+			ValuesYaml:       valuesYaml,
+			DependencyUpdate: boolFlag(cmd, flagDependencyUpdate),
+			Verify:           boolFlag(cmd, flagVerify),
+			Keyring:          stringFlag(cmd, flagKeyring),
+			Strict:           boolFlag(cmd, flagStrict),
+		}
+		if err := config.BuildHelmConfigFromPath(file.Root, filepath.Dir(file.Path)); err != nil {
+			return fmt.Errorf("%s: %w", file.Path, err)
+		}
+		if lock.Has(config.Chart, config.Repository, config.ChartVersion) {
+			continue
+		}
+		lockedChart, err := config.LockChart()
+		if err != nil {
+			return &renderError{
+				ValuesFile:   file.Path,
+				Chart:        config.Chart,
+				ChartVersion: config.ChartVersion,
+				Err:          err,
+			}
+		}
+		lock.Charts = append(lock.Charts, lockedChart)
+	}
+	return lock.Write(lockFile)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLock(t *testing.T) {
+	lockFile := filepath.Join(t.TempDir(), "helm-generate.lock")
+	newCmd := func(locked bool) *cobra.Command {
+		mockCmd := &cobra.Command{
+			Use:  "helm-generate [root-path]",
+			Args: cobra.RangeArgs(0, 1),
+		}
+		mockCmd.PersistentFlags().String(flagDefaultChart, "tests/chart", "")
+		mockCmd.PersistentFlags().String(flagDefaultChartVersion, "1.0.0", "")
+		mockCmd.Flags().String(flagHelmYamlFilename, ".helm.yaml", "")
+		mockCmd.Flags().StringP(flagHelmValuesFilename, "f", "values.yaml", "")
+		mockCmd.Flags().StringP(flagPostRenderBinary, "p", "", "")
+		mockCmd.Flags().StringArray(flagSetKeyValue, []string{"cluster=cluster-name"}, "")
+		mockCmd.Flags().String(flagLockFile, lockFile, "")
+		mockCmd.Flags().Bool(flagLocked, locked, "")
+		return mockCmd
+	}
+	sample := "tests/samples/multiple-apps"
+
+	_, err := helmGenerate(newCmd(true), []string{sample})
+	assert.Error(t, err, "should fail without a lock file")
+
+	err = helmLock(newCmd(false), []string{sample})
+	assert.NoError(t, err, "should not return error")
+	lock, err := os.ReadFile(lockFile)
+	assert.NoError(t, err, "should write the lock file")
+	assert.Equal(t, 2, strings.Count(string(lock), "- chart:"), "should lock every chart once")
+
+	_, err = helmGenerate(newCmd(true), []string{sample})
+	assert.NoError(t, err, "should render locked charts")
+
+	tampered := strings.Replace(string(lock), "digest: sha256:", "digest: sha256:0", 1)
+	assert.NoError(t, os.WriteFile(lockFile, []byte(tampered), 0644))
+	_, err = helmGenerate(newCmd(true), []string{sample})
+	assert.Error(t, err, "should fail when a digest doesn't match")
+
+	err = helmLock(newCmd(false), []string{"tests/samples/invalid-chart"})
+	assert.Error(t, err, "should fail when a chart can't be located")
+}
+
+func TestLockLocalChartPaths(t *testing.T) {
+	chart, err := filepath.Abs("tests/chart")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := t.TempDir()
+	files := map[string]string{
+		"app1/values.yaml": "namespace: ns\n",
+		"app2/values.yaml": "namespace: ns\n",
+		"app2/.helm.yaml":  "chart: " + chart + "\n",
+	}
+	for name, content := range files {
+		file := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lockFile := filepath.Join(root, "helm-generate.lock")
+	mockCmd := &cobra.Command{
+		Use:  "lock [root-path...]",
+		Args: cobra.ArbitraryArgs,
+	}
+	mockCmd.PersistentFlags().String(flagDefaultChart, "tests/chart", "")
+	mockCmd.PersistentFlags().String(flagDefaultChartVersion, "1.0.0", "")
+	mockCmd.Flags().String(flagHelmYamlFilename, ".helm.yaml", "")
+	mockCmd.Flags().StringP(flagHelmValuesFilename, "f", "values.yaml", "")
+	mockCmd.Flags().String(flagLockFile, lockFile, "")
+
+	err = helmLock(mockCmd, []string{root})
+	assert.NoError(t, err, "should not return error")
+	lock, err := os.ReadFile(lockFile)
+	assert.NoError(t, err, "should write the lock file")
+	assert.Equal(t, 1, strings.Count(string(lock), "- chart:"), "should lock a local chart once, whatever its path")
+}
@@ -3,17 +3,24 @@ package main
 import (
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
+	"runtime"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+
+	"github.com/topfreegames/helm-generate/pkg/helm"
+
+	"k8s.io/client-go/util/homedir"
 )
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
-	Use:   "helm-generate [root-path]",
+	Use:   "helm-generate [root-path...]",
 	Short: "templates helm charts and prints it to stdout",
 	Long:  ``,
-	Args:  cobra.RangeArgs(0, 1),
+	Args:  cobra.ArbitraryArgs,
 	Run: func(cmd *cobra.Command, args []string) {
 		buf, err := helmGenerate(cmd, args)
 		if err != nil {
@@ -30,6 +37,36 @@ var (
 	flagHelmYamlFilename    = "helm-yaml"
 	flagHelmValuesFilename  = "values-yaml"
 	flagSetKeyValue         = "set"
+	flagSetString           = "set-string"
+	flagSetFile             = "set-file"
+	flagSetJSON             = "set-json"
+	flagConcurrency         = "concurrency"
+	flagOutputDir           = "output-dir"
+	flagOutputLayout        = "output-layout"
+	flagOutputFormat        = "output-format"
+	flagSort                = "sort"
+	flagClusterScopedKinds  = "cluster-scoped-kinds"
+	flagAPIResourcesFile    = "api-resources-file"
+	flagKeepGoing           = "keep-going"
+	flagOffline             = "offline"
+	flagKubeVersion         = "kube-version"
+	flagAPIVersions         = "api-versions"
+	flagAPIVersionsFile     = "api-versions-file"
+	flagChartCacheDir       = "chart-cache-dir"
+	flagLockFile            = "lock-file"
+	flagLocked              = "locked"
+	flagDependencyUpdate    = "dependency-update"
+	flagVerify              = "verify"
+	flagKeyring             = "keyring"
+	flagReleaseNameKey      = "release-name-key"
+	flagNamespaceKey        = "namespace-key"
+	flagIgnoreFilename      = "ignore-file"
+	flagInclude             = "include"
+	flagExclude             = "exclude"
+	flagFromFile            = "from-file"
+	flagBasePath            = "base-path"
+	flagFollowSymlinks      = "follow-symlinks"
+	flagStrict              = "strict"
 )
 
 // initConfig reads in config file and ENV variables if set.
@@ -58,10 +95,52 @@ func init() {
 		log.Fatalf("error binding viper for flag HELM_DEFAULT_CHART_VERSION")
 	}
 
-	rootCmd.Flags().String(flagHelmYamlFilename, ".helm.yaml", "File to look for helm chart configuration (Defaults to .helm.yaml)")
-	rootCmd.Flags().StringP(flagHelmValuesFilename, "f", "values.yaml", "Filename of the helm values file (Defaults to values.yaml)")
-	rootCmd.Flags().StringP(flagPostRenderBinary, "p", "", "A command to run after rendering the Helm templates")
-	rootCmd.Flags().StringArray(flagSetKeyValue, []string{}, "List of <key>=<value> strings representing a property and its value to be assigned on the top level of the chart values.")
+	rootCmd.PersistentFlags().String(flagHelmYamlFilename, ".helm.yaml", "File to look for helm chart configuration (Defaults to .helm.yaml)")
+	rootCmd.PersistentFlags().StringP(flagHelmValuesFilename, "f", "values.yaml", "Filename of the helm values file (Defaults to values.yaml)")
+	rootCmd.PersistentFlags().String(flagFromFile, "", "File listing root paths, one per line, rendered along with the ones given as arguments ('-' reads them from stdin)")
+	rootCmd.PersistentFlags().String(flagBasePath, "", "Folder containing every root path, from which the .helm.yaml files are inherited (Defaults to each root path)")
+	rootCmd.PersistentFlags().Bool(flagStrict, false, "Fail on unknown keys on .helm.yaml files instead of ignoring them")
+	rootCmd.PersistentFlags().Bool(flagFollowSymlinks, false, "Descend into symlinked folders, skipping symlink cycles and dangling symlinks with a warning")
+	rootCmd.PersistentFlags().String(flagIgnoreFilename, defaultIgnoreFilename, "File listing, in gitignore syntax, the paths skipped while looking for values files (Defaults to .helmgenerateignore)")
+	rootCmd.PersistentFlags().StringSlice(flagInclude, []string{}, "Only render the folders, relative to the root path, matching one of these globs or inside a matching folder (can specify multiple)")
+	rootCmd.PersistentFlags().StringSlice(flagExclude, []string{}, "Skip the folders, relative to the root path, matching one of these globs or inside a matching folder (can specify multiple)")
+	rootCmd.PersistentFlags().StringP(flagPostRenderBinary, "p", "", "A command to run after rendering the Helm templates")
+	rootCmd.Flags().StringSlice(flagClusterScopedKinds, []string{}, "Additional cluster-scoped kinds that must not have the namespace injected")
+	rootCmd.Flags().String(flagAPIResourcesFile, "", "Output of kubectl api-resources used to find out which kinds are cluster-scoped")
+	rootCmd.Flags().Bool(flagOffline, false, "Never contact the cluster on the kubeconfig to find out its Kubernetes version")
+	rootCmd.Flags().String(flagKubeVersion, "", "Kubernetes version used for Capabilities.KubeVersion (Defaults to KUBE_VERSION env var)")
+	rootCmd.Flags().StringSlice(flagAPIVersions, []string{}, "Kubernetes api versions used for Capabilities.APIVersions (can specify multiple)")
+	rootCmd.Flags().String(flagAPIVersionsFile, "", "File with one Kubernetes api version used for Capabilities.APIVersions per line")
+	rootCmd.Flags().String(flagChartCacheDir, "", "Folder where the archives of remote charts with exact versions are kept between runs")
+	rootCmd.PersistentFlags().Bool(flagDependencyUpdate, false, "Download the missing dependencies of local charts before rendering them")
+	rootCmd.PersistentFlags().Bool(flagVerify, false, "Verify the provenance of the charts before rendering them")
+	rootCmd.PersistentFlags().String(flagKeyring, defaultKeyring(), "Keyring containing the public keys used to verify the charts")
+	rootCmd.PersistentFlags().String(flagReleaseNameKey, helm.DefaultReleaseNameKey, "Values key holding the release name, nested keys separated by dots (Defaults to releaseName)")
+	rootCmd.PersistentFlags().String(flagNamespaceKey, helm.DefaultNamespaceKey, "Values key holding the namespace, nested keys separated by dots (Defaults to namespace)")
+	rootCmd.PersistentFlags().String(flagLockFile, "", "Lock file pinning the charts to exact versions and digests (Defaults to helm-generate.lock on the base path or on the only root path)")
+	rootCmd.Flags().Bool(flagLocked, false, "Fail if a chart is not on the lock file or doesn't match its locked digest")
+	rootCmd.Flags().String(flagOutputDir, "", "Write the manifests to files under this folder instead of printing them to stdout")
+	rootCmd.Flags().String(flagOutputLayout, outputLayoutResource, "Files written to --output-dir: 'resource' for <namespace>/<release>/<kind>-<name>.yaml or 'release' for <namespace>/<release>.yaml")
+	rootCmd.Flags().String(flagOutputFormat, outputFormatYAML, "Format of the manifests: 'yaml', 'json', 'jsonl' (one JSON document per line) or 'list' (a single v1/List JSON document)")
+	rootCmd.Flags().Bool(flagSort, false, "Sort the manifests in Helm's install order by kind, then by namespace and name")
+	rootCmd.Flags().IntP(flagConcurrency, "j", runtime.NumCPU(), "Number of directories rendered in parallel (Defaults to the number of CPUs)")
+	rootCmd.Flags().BoolP(flagKeepGoing, "k", false, "Render every folder even if some fail, reporting all failures at the end")
+	rootCmd.PersistentFlags().StringArray(flagSetKeyValue, []string{}, "Set values on the command line, using Helm's syntax (can specify multiple or separate values with commas: key1=val1,key2=val2)")
+	rootCmd.PersistentFlags().StringArray(flagSetString, []string{}, "Set STRING values on the command line (can specify multiple or separate values with commas: key1=val1,key2=val2)")
+	rootCmd.PersistentFlags().StringArray(flagSetFile, []string{}, "Set values from respective files specified via the command line (can specify multiple or separate values with commas: key1=path1,key2=path2)")
+	rootCmd.PersistentFlags().StringArray(flagSetJSON, []string{}, "Set JSON values on the command line (can specify multiple: key1=jsonval1)")
+
+	rootCmd.AddCommand(lockCmd)
+	rootCmd.AddCommand(listCmd)
+	rootCmd.AddCommand(validateCmd)
+}
+
+// defaultKeyring returns the same default keyring used by helm
+func defaultKeyring() string {
+	if v, ok := os.LookupEnv("GNUPGHOME"); ok {
+		return filepath.Join(v, "pubring.gpg")
+	}
+	return filepath.Join(homedir.HomeDir(), ".gnupg", "pubring.gpg")
 }
 
 func main() {
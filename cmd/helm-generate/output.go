@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/topfreegames/helm-generate/pkg/util"
+)
+
+const (
+	// outputLayoutResource writes one file per resource
+	outputLayoutResource = "resource"
+	// outputLayoutRelease writes one file per release
+	outputLayoutRelease = "release"
+
+	// outputFormatYAML writes a stream of YAML documents
+	outputFormatYAML = "yaml"
+	// outputFormatJSON writes a stream of indented JSON documents
+	outputFormatJSON = "json"
+	// outputFormatJSONLines writes one JSON document per line
+	outputFormatJSONLines = "jsonl"
+	// outputFormatList writes a single v1/List JSON document
+	outputFormatList = "list"
+
+	// outputIndexFilename lists, on the output folder, the files written by the last
+	// run, so only those are removed when they aren't written again
+	outputIndexFilename = ".helm-generate-files"
+)
+
+// outputExtension returns the file extension used for an output format
+func outputExtension(format string) (string, error) {
+	switch format {
+	case outputFormatYAML, "":
+		return ".yaml", nil
+	case outputFormatJSON, outputFormatList:
+		return ".json", nil
+	case outputFormatJSONLines:
+		return ".jsonl", nil
+	}
+	return "", fmt.Errorf("unknown output format %q", format)
+}
+
+// isManifestFile checks if a file has the extension of any output format
+func isManifestFile(path string) bool {
+	switch filepath.Ext(path) {
+	case ".yaml", ".json", ".jsonl":
+		return true
+	}
+	return false
+}
+
+// encodeManifests writes the manifests to w using the given output format
+func encodeManifests(w io.Writer, format string, manifests []map[string]interface{}) error {
+	switch format {
+	case outputFormatYAML, "":
+		encode := yamlEncoder(yaml.NewEncoder(w))
+		for _, manifest := range manifests {
+			encode(manifest)
+		}
+		return nil
+	case outputFormatJSON, outputFormatJSONLines:
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		if format == outputFormatJSON {
+			enc.SetIndent("", "  ")
+		}
+		for _, manifest := range manifests {
+			if err := enc.Encode(util.ToJSONCompatible(manifest)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case outputFormatList:
+		items := make([]interface{}, 0, len(manifests))
+		for _, manifest := range manifests {
+			items = append(items, util.ToJSONCompatible(manifest))
+		}
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		return enc.Encode(map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "List",
+			"items":      items,
+		})
+	}
+	return fmt.Errorf("unknown output format %q", format)
+}
+
+// outputPath returns the file, relative to the output folder, where a resource is written.
+// Namespaces are written next to the releases of the namespace, every other resource
+// is grouped by the namespace and name of its release.
+func outputPath(resource util.Resource, layout string, extension string) (string, error) {
+	kind, name := resource.KindAndName()
+	if kind == "" || name == "" {
+		return "", fmt.Errorf("resource rendered from %s has no kind or name", resource.Source)
+	}
+	if kind == "Namespace" {
+		return filepath.Join(name, fmt.Sprintf("namespace-%s%s", name, extension)), nil
+	}
+
+	switch layout {
+	case outputLayoutResource, "":
+		filename := fmt.Sprintf("%s-%s%s", strings.ToLower(kind), name, extension)
+		return filepath.Join(resource.Namespace, resource.Release, filename), nil
+	case outputLayoutRelease:
+		return filepath.Join(resource.Namespace, resource.Release+extension), nil
+	}
+	return "", fmt.Errorf("unknown output layout %q", layout)
+}
+
+// writeOutputDir writes the resources to files under outputDir, following the given
+// layout and format, and removes the files written by the previous run that weren't
+// written again. Files not written by helm-generate are left untouched.
+func writeOutputDir(outputDir string, layout string, format string, resources []util.Resource) error {
+	extension, err := outputExtension(format)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(outputDir, 0o755); err != nil {
+		return err
+	}
+	var paths []string
+	files := make(map[string][]util.Resource)
+	for _, resource := range resources {
+		path, err := outputPath(resource, layout, extension)
+		if err != nil {
+			return err
+		}
+		if _, ok := files[path]; !ok {
+			paths = append(paths, path)
+		} else if layout != outputLayoutRelease {
+			return fmt.Errorf("resources rendered from %s and %s would be written to the same file %s",
+				files[path][0].Source, resource.Source, path)
+		}
+		files[path] = append(files[path], resource)
+	}
+	previous, err := readOutputIndex(outputDir)
+	if err != nil {
+		return err
+	}
+
+	written := make(map[string]bool)
+	for _, path := range paths {
+		var manifests []map[string]interface{}
+		for _, resource := range files[path] {
+			manifests = append(manifests, resource.Manifest)
+		}
+		var buf bytes.Buffer
+		if err := encodeManifests(&buf, format, manifests); err != nil {
+			return err
+		}
+		fullPath := filepath.Join(outputDir, path)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(fullPath, buf.Bytes(), 0o644); err != nil {
+			return err
+		}
+		written[filepath.ToSlash(path)] = true
+	}
+	if err := removeStaleFiles(outputDir, previous, written); err != nil {
+		return err
+	}
+	return writeOutputIndex(outputDir, paths)
+}
+
+// readOutputIndex returns the files, relative to outputDir, written by the previous run
+func readOutputIndex(outputDir string) ([]string, error) {
+	content, err := os.ReadFile(filepath.Join(outputDir, outputIndexFilename))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error reading output index: %w", err)
+	}
+	var files []string
+	for _, line := range strings.Split(string(content), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			files = append(files, line)
+		}
+	}
+	return files, nil
+}
+
+// writeOutputIndex records the files written to outputDir, one per line
+func writeOutputIndex(outputDir string, paths []string) error {
+	var b strings.Builder
+	for _, path := range paths {
+		b.WriteString(filepath.ToSlash(path) + "\n")
+	}
+	return os.WriteFile(filepath.Join(outputDir, outputIndexFilename), []byte(b.String()), 0o644)
+}
+
+// removeStaleFiles removes the manifest files written by the previous run that weren't
+// written again, and the folders left empty afterwards. Entries of the index that
+// aren't manifests or point outside outputDir are ignored.
+func removeStaleFiles(outputDir string, previous []string, written map[string]bool) error {
+	for _, file := range previous {
+		rel := filepath.Clean(filepath.FromSlash(file))
+		if written[filepath.ToSlash(rel)] || !isManifestFile(rel) || filepath.IsAbs(rel) ||
+			rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(outputDir, rel)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		// Remove the parent folders left empty, up to the output folder
+		for dir := filepath.Dir(rel); dir != "."; dir = filepath.Dir(dir) {
+			entries, err := os.ReadDir(filepath.Join(outputDir, dir))
+			if err != nil || len(entries) > 0 {
+				break
+			}
+			if err := os.Remove(filepath.Join(outputDir, dir)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkOutputDir fails if outputDir is a root path or inside one, where the written
+// files would be mixed with the values files being rendered
+func checkOutputDir(outputDir string, roots []string) error {
+	for _, root := range roots {
+		inside, err := isInside(root, outputDir)
+		if err != nil {
+			return err
+		}
+		if inside {
+			return fmt.Errorf("output folder %s can't be inside the root path %s", outputDir, root)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/topfreegames/helm-generate/pkg/util"
+)
+
+func TestOutputPath(t *testing.T) {
+	deployment := util.Resource{
+		Manifest: map[string]interface{}{
+			"kind":     "Deployment",
+			"metadata": map[interface{}]interface{}{"name": "web"},
+		},
+		Release:   "app",
+		Namespace: "ns",
+	}
+	namespace := util.Resource{
+		Manifest: util.CreateNamespace("ns", nil, nil),
+		Release:  "app",
+	}
+	tests := []TestCase{
+		{
+			Name:     "resource layout",
+			Sample:   []interface{}{deployment, outputLayoutResource},
+			Expected: "ns/app/deployment-web.yaml",
+		},
+		{
+			Name:     "release layout",
+			Sample:   []interface{}{deployment, outputLayoutRelease},
+			Expected: "ns/app.yaml",
+		},
+		{
+			Name:     "namespace",
+			Sample:   []interface{}{namespace, outputLayoutRelease},
+			Expected: "ns/namespace-ns.yaml",
+		},
+		{
+			Name:     "unknown layout",
+			Sample:   []interface{}{deployment, "flat"},
+			Expected: nil,
+		},
+		{
+			Name:     "resource without name",
+			Sample:   []interface{}{util.Resource{Manifest: map[string]interface{}{"kind": "Secret"}}, outputLayoutResource},
+			Expected: nil,
+		},
+	}
+	for i, test := range tests {
+		t.Logf("Test case %d: %s", i, test.Name)
+		sample := test.Sample.([]interface{})
+		path, err := outputPath(sample[0].(util.Resource), sample[1].(string), ".yaml")
+		if test.Expected == nil {
+			assert.Error(t, err, "should return an error")
+		} else {
+			assert.Nil(t, err, "should not return error")
+			assert.Equal(t, filepath.FromSlash(test.Expected.(string)), path, "should match the expected path")
+		}
+	}
+}
+
+func TestWriteOutputDir(t *testing.T) {
+	outputDir := t.TempDir()
+	unrelated := []string{
+		filepath.Join(outputDir, "README.md"),
+		filepath.Join(outputDir, "kustomization.yaml"),
+		filepath.Join(outputDir, "old-ns", "old-app", "kustomization.yaml"),
+	}
+	for _, file := range unrelated {
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatalf("couldn't create test folder: %v", err)
+		}
+		if err := os.WriteFile(file, []byte("unrelated"), 0o644); err != nil {
+			t.Fatalf("couldn't create test file: %v", err)
+		}
+	}
+
+	stale := []util.Resource{
+		{
+			Manifest: map[string]interface{}{
+				"apiVersion": "apps/v1",
+				"kind":       "Deployment",
+				"metadata":   map[interface{}]interface{}{"name": "old", "namespace": "old-ns"},
+			},
+			Release:   "old-app",
+			Namespace: "old-ns",
+		},
+		{
+			Manifest: map[string]interface{}{
+				"apiVersion": "apps/v1",
+				"kind":       "Deployment",
+				"metadata":   map[interface{}]interface{}{"name": "gone", "namespace": "gone-ns"},
+			},
+			Release:   "gone-app",
+			Namespace: "gone-ns",
+		},
+	}
+	err := writeOutputDir(outputDir, outputLayoutResource, outputFormatYAML, stale)
+	assert.Nil(t, err, "should not return error")
+
+	resources := []util.Resource{
+		{
+			Manifest: util.CreateNamespace("ns", nil, nil),
+			Release:  "app",
+		},
+		{
+			Manifest: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "ConfigMap",
+				"metadata":   map[interface{}]interface{}{"name": "config", "namespace": "ns"},
+			},
+			Release:   "app",
+			Namespace: "ns",
+		},
+	}
+	err = writeOutputDir(outputDir, outputLayoutResource, outputFormatYAML, resources)
+	assert.Nil(t, err, "should not return error")
+
+	configMap, err := os.ReadFile(filepath.Join(outputDir, "ns", "app", "configmap-config.yaml"))
+	assert.Nil(t, err, "should write one file per resource")
+	assert.Equal(t, "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config\n  namespace: ns\n", string(configMap))
+	_, err = os.Stat(filepath.Join(outputDir, "ns", "namespace-ns.yaml"))
+	assert.Nil(t, err, "should write the namespace next to its releases")
+	_, err = os.Stat(filepath.Join(outputDir, "old-ns", "old-app", "deployment-old.yaml"))
+	assert.True(t, os.IsNotExist(err), "should remove files written by the previous run")
+	_, err = os.Stat(filepath.Join(outputDir, "gone-ns"))
+	assert.True(t, os.IsNotExist(err), "should remove folders left empty")
+	for _, file := range unrelated {
+		_, err = os.Stat(file)
+		assert.Nil(t, err, "should keep files not written by helm-generate")
+	}
+
+	duplicated := append(resources, resources[1])
+	err = writeOutputDir(outputDir, outputLayoutResource, outputFormatYAML, duplicated)
+	assert.Error(t, err, "should not write two resources to the same file")
+}
+
+func TestCheckOutputDir(t *testing.T) {
+	tests := []TestCase{
+		{
+			Name:     "output folder outside the root paths",
+			Sample:   []string{"out", "apps", "infra"},
+			Expected: "",
+		},
+		{
+			Name:     "output folder is a root path",
+			Sample:   []string{"apps", "infra", "apps/"},
+			Expected: "output folder apps can't be inside the root path apps/",
+		},
+		{
+			Name:     "output folder inside a root path",
+			Sample:   []string{"out", "."},
+			Expected: "output folder out can't be inside the root path .",
+		},
+	}
+	for i, test := range tests {
+		t.Logf("Test case %d: %s", i, test.Name)
+		sample := test.Sample.([]string)
+		err := checkOutputDir(sample[0], sample[1:])
+		if test.Expected.(string) == "" {
+			assert.Nil(t, err, "should not return error")
+		} else {
+			assert.EqualError(t, err, test.Expected.(string), "should refuse the output folder")
+		}
+	}
+}
+
+func TestEncodeManifests(t *testing.T) {
+	manifests := []map[string]interface{}{
+		{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[interface{}]interface{}{"name": "a"},
+			"data":       map[interface{}]interface{}{"url": "http://host/?a=1&b=2"},
+		},
+		{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[interface{}]interface{}{"name": "b"},
+		},
+	}
+	tests := []TestCase{
+		{
+			Name:   "yaml",
+			Sample: outputFormatYAML,
+			Expected: `apiVersion: v1
+data:
+  url: http://host/?a=1&b=2
+kind: ConfigMap
+metadata:
+  name: a
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: b
+`,
+		},
+		{
+			Name:   "json lines",
+			Sample: outputFormatJSONLines,
+			Expected: `{"apiVersion":"v1","data":{"url":"http://host/?a=1&b=2"},"kind":"ConfigMap","metadata":{"name":"a"}}
+{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"b"}}
+`,
+		},
+		{
+			Name:   "json",
+			Sample: outputFormatJSON,
+			Expected: `{
+  "apiVersion": "v1",
+  "data": {
+    "url": "http://host/?a=1&b=2"
+  },
+  "kind": "ConfigMap",
+  "metadata": {
+    "name": "a"
+  }
+}
+{
+  "apiVersion": "v1",
+  "kind": "ConfigMap",
+  "metadata": {
+    "name": "b"
+  }
+}
+`,
+		},
+		{
+			Name:   "list",
+			Sample: outputFormatList,
+			Expected: `{
+  "apiVersion": "v1",
+  "items": [
+    {
+      "apiVersion": "v1",
+      "data": {
+        "url": "http://host/?a=1&b=2"
+      },
+      "kind": "ConfigMap",
+      "metadata": {
+        "name": "a"
+      }
+    },
+    {
+      "apiVersion": "v1",
+      "kind": "ConfigMap",
+      "metadata": {
+        "name": "b"
+      }
+    }
+  ],
+  "kind": "List"
+}
+`,
+		},
+		{
+			Name:     "unknown format",
+			Sample:   "xml",
+			Expected: nil,
+		},
+	}
+	for i, test := range tests {
+		t.Logf("Test case %d: %s", i, test.Name)
+		var buf bytes.Buffer
+		err := encodeManifests(&buf, test.Sample.(string), manifests)
+		if test.Expected == nil {
+			assert.Error(t, err, "should return an error")
+		} else {
+			assert.Nil(t, err, "should not return error")
+			assert.Equal(t, test.Expected.(string), buf.String(), "should match the expected output")
+		}
+	}
+}
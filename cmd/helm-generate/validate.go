@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// validateCmd checks the configuration of every folder without rendering any chart
+var validateCmd = &cobra.Command{
+	Use:   "validate [root-path...]",
+	Short: "checks the .helm.yaml and values files of every folder without rendering the charts",
+	Long:  ``,
+	Args:  cobra.ArbitraryArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := helmValidate(cmd, args, os.Stdout); err != nil {
+			log.Fatalf("Error validating configuration: %s", err)
+		}
+	},
+}
+
+// helmValidate discovers the values files with the same rules as helmGenerate and
+// validates the configuration of each one, writing every problem found
+func helmValidate(cmd *cobra.Command, args []string, w io.Writer) error {
+	roots, err := rootPaths(cmd, args)
+	if err != nil {
+		return err
+	}
+	keyValueAssignments, err := parseKeyValueAssignments(cmd)
+	if err != nil {
+		return fmt.Errorf("error parsing key-value assignments: %w", err)
+	}
+	discovery, err := newDiscoveryOptions(cmd)
+	if err != nil {
+		return err
+	}
+	valuesFiles, err := discoverRoots(roots, stringFlag(cmd, flagBasePath), discovery)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, file := range valuesFiles {
+		errs := newConfig(cmd, keyValueAssignments).Validate(file.Root, file.Path)
+		if len(errs) == 0 {
+			continue
+		}
+		failed++
+		fmt.Fprintf(w, "%s:\n", file.Path)
+		for _, err := range errs {
+			fmt.Fprintf(w, "  - %s\n", err)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d values file(s) have an invalid configuration", failed, len(valuesFiles))
+	}
+	fmt.Fprintf(w, "%d values file(s) are valid\n", len(valuesFiles))
+	return nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func newValidateCmd() *cobra.Command {
+	mockCmd := &cobra.Command{
+		Use:  "validate [root-path...]",
+		Args: cobra.ArbitraryArgs,
+	}
+	mockCmd.PersistentFlags().String(flagDefaultChart, "tests/chart", "")
+	mockCmd.PersistentFlags().String(flagDefaultChartVersion, "1.0.0", "")
+	mockCmd.Flags().String(flagHelmYamlFilename, ".helm.yaml", "")
+	mockCmd.Flags().StringP(flagHelmValuesFilename, "f", "values.yaml", "")
+	mockCmd.Flags().StringArray(flagSetKeyValue, []string{}, "")
+	return mockCmd
+}
+
+func TestValidate(t *testing.T) {
+	var b bytes.Buffer
+	err := helmValidate(newValidateCmd(), []string{"tests/samples/multiple-apps", "tests/samples/release-identity"}, &b)
+	assert.NoError(t, err, "should not return error")
+	assert.Equal(t, "5 values file(s) are valid\n", b.String(), "should count the valid values files")
+
+	b.Reset()
+	err = helmValidate(newValidateCmd(), []string{"tests/samples/multiple-apps", "tests/samples/missing-required-fields"}, &b)
+	assert.EqualError(t, err, "1 of 4 values file(s) have an invalid configuration", "should count the invalid values files")
+	assert.Equal(t, "tests/samples/missing-required-fields/values.yaml:\n  - Missing required field [namespace]\n", b.String(), "should list the problems of each values file")
+}
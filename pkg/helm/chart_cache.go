@@ -0,0 +1,180 @@
+package helm
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/mitchellh/copystructure"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+)
+
+// ChartCache keeps the charts loaded during a run, so folders rendering the same chart
+// and version only locate and parse it once. When created with a folder, the archives
+// of remote charts pinned to an exact version are also kept on disk across runs.
+type ChartCache struct {
+	dir     string
+	mu      sync.Mutex
+	entries map[chartKey]*chartEntry
+}
+
+type chartKey struct {
+	repository string
+	chart      string
+	version    string
+	verify     bool
+	// keyring is only set when verifying, so the provenance is checked again for every
+	// keyring the chart is verified against
+	keyring string
+	// dependencyUpdate is part of the key as dependencies are downloaded while locating
+	// the chart, which only happens the first time a key is requested
+	dependencyUpdate bool
+}
+
+type chartEntry struct {
+	once  sync.Once
+	chart *chart.Chart
+	err   error
+}
+
+// NewChartCache creates a ChartCache, persisting chart archives on dir unless it's empty
+func NewChartCache(dir string) *ChartCache {
+	return &ChartCache{
+		dir:     dir,
+		entries: map[chartKey]*chartEntry{},
+	}
+}
+
+// get returns a copy of the chart for key, calling locate to find out the chart path
+// and check to validate it the first time it is requested. Callers can change the
+// returned chart freely, as Helm does when processing dependencies.
+func (c *ChartCache) get(key chartKey, locate func() (string, error), check func(path string) error) (*chart.Chart, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = &chartEntry{}
+		c.entries[key] = entry
+	}
+	c.mu.Unlock()
+
+	entry.once.Do(func() {
+		entry.chart, entry.err = c.load(key, locate, check)
+	})
+	if entry.err != nil {
+		return nil, entry.err
+	}
+	return copyChart(entry.chart)
+}
+
+// load reads the chart from the disk cache if available, otherwise it locates the chart
+// and stores its archive on the disk cache
+func (c *ChartCache) load(key chartKey, locate func() (string, error), check func(path string) error) (*chart.Chart, error) {
+	archive := c.archivePath(key)
+	if archive != "" {
+		if _, err := os.Stat(archive); err == nil {
+			if err := check(archive); err != nil {
+				return nil, err
+			}
+			return loader.Load(archive)
+		}
+	}
+
+	path, err := locate()
+	if err != nil {
+		return nil, err
+	}
+	if err := check(path); err != nil {
+		return nil, err
+	}
+	if archive != "" {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			if err := copyFile(path, archive); err != nil {
+				return nil, fmt.Errorf("Error writing chart to cache: %w", err)
+			}
+		}
+	}
+	return loader.Load(path)
+}
+
+// archivePath returns the path where the chart archive is cached on disk, or an empty
+// string if the chart can't be cached: local charts may change between runs, version
+// ranges may resolve to a different chart and verified charts need their provenance.
+func (c *ChartCache) archivePath(key chartKey) string {
+	if c.dir == "" || key.verify {
+		return ""
+	}
+	if _, err := os.Stat(key.chart); err == nil && key.repository == "" {
+		return ""
+	}
+	if _, err := semver.StrictNewVersion(key.version); err != nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(key.repository + "\n" + key.chart + "\n" + key.version))
+	return filepath.Join(c.dir, fmt.Sprintf("%s-%s-%x.tgz", filepath.Base(key.chart), key.version, sum[:8]))
+}
+
+// copyFile copies src into dst through a temporary file, so concurrent runs sharing the
+// cache never read a partially written archive
+func copyFile(src string, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(out.Name(), dst)
+}
+
+// copyChart deep copies the parts of a chart that Helm changes while rendering: values,
+// dependencies metadata and the dependency tree itself. Templates and files are shared.
+func copyChart(c *chart.Chart) (*chart.Chart, error) {
+	cp := *c
+	values, err := copystructure.Copy(c.Values)
+	if err != nil {
+		return nil, fmt.Errorf("Error copying chart values: %w", err)
+	}
+	cp.Values, _ = values.(map[string]interface{})
+
+	if c.Metadata != nil {
+		metadata := *c.Metadata
+		if c.Metadata.Dependencies != nil {
+			metadata.Dependencies = make([]*chart.Dependency, 0, len(c.Metadata.Dependencies))
+			for _, dependency := range c.Metadata.Dependencies {
+				d := *dependency
+				metadata.Dependencies = append(metadata.Dependencies, &d)
+			}
+		}
+		cp.Metadata = &metadata
+	}
+
+	dependencies := make([]*chart.Chart, 0, len(c.Dependencies()))
+	for _, dependency := range c.Dependencies() {
+		d, err := copyChart(dependency)
+		if err != nil {
+			return nil, err
+		}
+		dependencies = append(dependencies, d)
+	}
+	cp.SetDependencies(dependencies...)
+	return &cp, nil
+}
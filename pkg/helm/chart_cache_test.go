@@ -0,0 +1,130 @@
+package helm
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+func newCachedChart() *chart.Chart {
+	subchart := &chart.Chart{
+		Metadata: &chart.Metadata{APIVersion: chart.APIVersionV2, Name: "subchart", Version: "1.0.0"},
+		Values:   map[string]interface{}{"enabled": true},
+		Raw:      []*chart.File{{Name: chartutil.ValuesfileName, Data: []byte("enabled: true\n")}},
+	}
+	c := &chart.Chart{
+		Metadata: &chart.Metadata{
+			APIVersion: chart.APIVersionV2,
+			Name:       "cached",
+			Version:    "1.0.0",
+			Dependencies: []*chart.Dependency{
+				{Name: "subchart", Version: "1.0.0", Condition: "subchart.enabled"},
+			},
+		},
+		Values: map[string]interface{}{
+			"image": map[string]interface{}{"tag": "latest"},
+		},
+		Raw: []*chart.File{{Name: chartutil.ValuesfileName, Data: []byte("image:\n  tag: latest\n")}},
+	}
+	c.SetDependencies(subchart)
+	return c
+}
+
+func noCheck(path string) error {
+	return nil
+}
+
+func TestChartCacheGet(t *testing.T) {
+	archive, err := chartutil.Save(newCachedChart(), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := 0
+	locate := func() (string, error) {
+		calls++
+		return archive, nil
+	}
+
+	cache := NewChartCache("")
+	first, err := cache.get(chartKey{chart: "repo/cached", version: "1.0.0"}, locate, noCheck)
+	assert.Nil(t, err, "should not return error")
+	first.Values["image"].(map[string]interface{})["tag"] = "changed"
+	err = chartutil.ProcessDependencies(first, map[string]interface{}{"subchart": map[string]interface{}{"enabled": false}})
+	assert.Nil(t, err, "should not return error")
+	assert.Empty(t, first.Dependencies(), "disabled dependency should be removed from the copy")
+
+	second, err := cache.get(chartKey{chart: "repo/cached", version: "1.0.0"}, locate, noCheck)
+	assert.Nil(t, err, "should not return error")
+	assert.Equal(t, 1, calls, "chart should be located only once")
+	assert.Equal(t, "latest", second.Values["image"].(map[string]interface{})["tag"], "changes to a copy must not leak into the cache")
+	assert.Len(t, second.Dependencies(), 1, "changes to a copy must not leak into the cache")
+	assert.Same(t, second, second.Dependencies()[0].Parent(), "dependencies should belong to the copy")
+	assert.False(t, second.Metadata.Dependencies[0].Enabled, "dependencies metadata must not leak into the cache")
+
+	_, err = cache.get(chartKey{chart: "repo/cached", version: "1.0.1"}, locate, noCheck)
+	assert.Nil(t, err, "should not return error")
+	assert.Equal(t, 2, calls, "other versions should be located")
+}
+
+func TestChartCacheGetError(t *testing.T) {
+	calls := 0
+	locate := func() (string, error) {
+		calls++
+		return "", errors.New("chart not found")
+	}
+	cache := NewChartCache("")
+	for i := 0; i < 2; i++ {
+		_, err := cache.get(chartKey{chart: "repo/missing", version: "1.0.0"}, locate, noCheck)
+		assert.Error(t, err, "should return an error")
+	}
+	assert.Equal(t, 1, calls, "chart should be located only once")
+}
+
+func TestChartCacheDisk(t *testing.T) {
+	archive, err := chartutil.Save(newCachedChart(), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cacheDir := t.TempDir()
+	locate := func() (string, error) { return archive, nil }
+	notFound := func() (string, error) { return "", errors.New("chart not found") }
+
+	tests := []TestCase{
+		{
+			Name:     "exact version is kept on disk",
+			Sample:   []string{"repo/cached", "1.0.0"},
+			Expected: false,
+		},
+		{
+			Name:     "version range is located again",
+			Sample:   []string{"repo/cached", "1.x"},
+			Expected: true,
+		},
+		{
+			Name:     "local chart is located again",
+			Sample:   []string{archive, "1.0.0"},
+			Expected: true,
+		},
+	}
+	for i, test := range tests {
+		t.Logf("Test case %d: %s", i, test.Name)
+		sample := test.Sample.([]string)
+		_, err := NewChartCache(cacheDir).get(chartKey{chart: sample[0], version: sample[1]}, locate, noCheck)
+		assert.Nil(t, err, "should not return error")
+
+		c, err := NewChartCache(cacheDir).get(chartKey{chart: sample[0], version: sample[1]}, notFound, noCheck)
+		if test.Expected.(bool) {
+			assert.Error(t, err, "should locate the chart again")
+		} else {
+			assert.Nil(t, err, "should load the chart from disk")
+			assert.Equal(t, "cached", c.Name(), "should load the cached chart")
+		}
+	}
+
+	_, err = os.Stat(archive)
+	assert.Nil(t, err, "located archive should be left untouched")
+}
@@ -0,0 +1,75 @@
+package helm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/downloader"
+	"helm.sh/helm/v3/pkg/getter"
+)
+
+// dependencyUpdates keeps the result of updating the dependencies of each local chart
+// folder, so charts shared by many folders are only updated once per run
+var dependencyUpdates sync.Map
+
+type dependencyUpdate struct {
+	once sync.Once
+	err  error
+}
+
+// updateDependencies downloads the dependencies declared on the Chart.yaml of a local
+// chart folder into its charts/ folder, unless they are already there. As with
+// helm dependency build, the versions on Chart.lock are used when it exists.
+func updateDependencies(chartPath string) error {
+	info, err := os.Stat(chartPath)
+	if err != nil || !info.IsDir() {
+		// Archives are packaged along with their dependencies
+		return nil
+	}
+	abs, err := filepath.Abs(chartPath)
+	if err != nil {
+		return err
+	}
+	value, _ := dependencyUpdates.LoadOrStore(abs, &dependencyUpdate{})
+	update := value.(*dependencyUpdate)
+	update.once.Do(func() {
+		update.err = buildDependencies(abs)
+	})
+	return update.err
+}
+
+func buildDependencies(chartPath string) error {
+	chartLoaded, err := loader.Load(chartPath)
+	if err != nil {
+		return err
+	}
+	dependencies := chartLoaded.Metadata.Dependencies
+	if len(dependencies) == 0 || action.CheckDependencies(chartLoaded, dependencies) == nil {
+		return nil
+	}
+
+	settings := cli.New()
+	registryClient, err := newRegistryClient(settings)
+	if err != nil {
+		return err
+	}
+	manager := &downloader.Manager{
+		Out:              os.Stderr,
+		ChartPath:        chartPath,
+		Getters:          getter.All(settings),
+		RegistryClient:   registryClient,
+		RepositoryConfig: settings.RepositoryConfig,
+		RepositoryCache:  settings.RepositoryCache,
+		Debug:            settings.Debug,
+	}
+	// Build honors Chart.lock, only resolving the dependencies again without it
+	if err := manager.Build(); err != nil {
+		return fmt.Errorf("Error building dependencies of chart %s: %w", chartPath, err)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package helm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/action"
+)
+
+// writeChartWithDependency creates a chart depending on a local subchart, without
+// the subchart on its charts/ folder
+func writeChartWithDependency(t *testing.T) string {
+	dir := t.TempDir()
+	files := map[string]string{
+		"app/Chart.yaml": `apiVersion: v2
+name: app
+version: 1.0.0
+dependencies:
+  - name: database
+    version: 1.0.0
+    repository: file://../database
+`,
+		"app/templates/configmap.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Release.Name }}-app
+`,
+		"database/Chart.yaml": `apiVersion: v2
+name: database
+version: 1.0.0
+`,
+		"database/templates/configmap.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Release.Name }}-database
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return filepath.Join(dir, "app")
+}
+
+func TestLoadChartDependencyUpdate(t *testing.T) {
+	cache := t.TempDir()
+	t.Setenv("HELM_REPOSITORY_CACHE", cache)
+	t.Setenv("HELM_REPOSITORY_CONFIG", filepath.Join(cache, "repositories.yaml"))
+
+	tests := []TestCase{
+		{
+			Name:     "missing dependencies",
+			Sample:   false,
+			Expected: ReturnWithError{Error: true},
+		},
+		{
+			Name:     "dependency update",
+			Sample:   true,
+			Expected: ReturnWithError{Value: []string{"database"}},
+		},
+	}
+	for i, test := range tests {
+		t.Logf("Test case %d: %s", i, test.Name)
+		expected := test.Expected.(ReturnWithError)
+		chartPath := writeChartWithDependency(t)
+
+		for _, cache := range []*ChartCache{nil, NewChartCache("")} {
+			h := Configuration{Chart: chartPath, ChartVersion: "1.0.0", DependencyUpdate: test.Sample.(bool), ChartCache: cache}
+			c, err := h.loadChart(&action.Install{})
+			if expected.Error {
+				assert.Error(t, err, "should return an error")
+				continue
+			}
+			assert.Nil(t, err, "should not return error")
+			var dependencies []string
+			for _, dependency := range c.Dependencies() {
+				dependencies = append(dependencies, dependency.Name())
+			}
+			assert.Equal(t, expected.Value, dependencies, "should load the downloaded dependencies")
+		}
+		_, err := os.Stat(filepath.Join(chartPath, "charts", "database-1.0.0.tgz"))
+		assert.Equal(t, expected.Error, os.IsNotExist(err), "dependencies should only be written on update")
+	}
+
+	// An existing Chart.lock is used as is
+	chartPath := writeChartWithDependency(t)
+	if err := buildDependencies(chartPath); err != nil {
+		t.Fatal(err)
+	}
+	lock, err := os.ReadFile(filepath.Join(chartPath, "Chart.lock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(filepath.Join(chartPath, "charts")); err != nil {
+		t.Fatal(err)
+	}
+	h := Configuration{Chart: chartPath, ChartVersion: "1.0.0", DependencyUpdate: true}
+	_, err = h.loadChart(&action.Install{})
+	assert.Nil(t, err, "should build the dependencies from Chart.lock")
+	lockAfter, err := os.ReadFile(filepath.Join(chartPath, "Chart.lock"))
+	assert.Nil(t, err, "should keep Chart.lock")
+	assert.Equal(t, string(lock), string(lockAfter), "should leave Chart.lock unchanged")
+
+	// A Chart.lock out of sync with Chart.yaml is reported instead of resolved again
+	chartPath = writeChartWithDependency(t)
+	outdated := "dependencies:\n- name: database\n  repository: file://../database\n  version: 0.1.0\ndigest: sha256:outdated\ngenerated: \"2022-01-01T00:00:00Z\"\n"
+	if err := os.WriteFile(filepath.Join(chartPath, "Chart.lock"), []byte(outdated), 0644); err != nil {
+		t.Fatal(err)
+	}
+	h = Configuration{Chart: chartPath, ChartVersion: "1.0.0", DependencyUpdate: true}
+	_, err = h.loadChart(&action.Install{})
+	assert.Error(t, err, "should fail with an out of sync Chart.lock")
+	lockAfter, err = os.ReadFile(filepath.Join(chartPath, "Chart.lock"))
+	assert.Nil(t, err, "should keep Chart.lock")
+	assert.Equal(t, outdated, string(lockAfter), "should leave Chart.lock unchanged")
+}
+
+func TestLoadChartDependencyUpdateCached(t *testing.T) {
+	cache := t.TempDir()
+	t.Setenv("HELM_REPOSITORY_CACHE", cache)
+	t.Setenv("HELM_REPOSITORY_CONFIG", filepath.Join(cache, "repositories.yaml"))
+
+	chartPath := writeChartWithDependency(t)
+	chartCache := NewChartCache("")
+	h := Configuration{Chart: chartPath, ChartVersion: "1.0.0", ChartCache: chartCache}
+	_, err := h.loadChart(&action.Install{})
+	assert.Error(t, err, "should fail without dependency update")
+
+	h = Configuration{Chart: chartPath, ChartVersion: "1.0.0", DependencyUpdate: true, ChartCache: chartCache}
+	c, err := h.loadChart(&action.Install{})
+	assert.Nil(t, err, "should update the dependencies of a chart already cached without them")
+	if assert.NotNil(t, c) {
+		assert.Len(t, c.Dependencies(), 1, "should load the downloaded dependencies")
+	}
+}
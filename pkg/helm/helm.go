@@ -1,10 +1,15 @@
 package helm
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 
 	"github.com/topfreegames/helm-generate/pkg/util"
 
@@ -16,8 +21,9 @@ import (
 	"helm.sh/helm/v3/pkg/chartutil"
 	"helm.sh/helm/v3/pkg/cli"
 	"helm.sh/helm/v3/pkg/postrender"
-        "k8s.io/client-go/discovery"
-        "sigs.k8s.io/controller-runtime/pkg/client/config"
+	"helm.sh/helm/v3/pkg/registry"
+	"k8s.io/client-go/discovery"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
 )
 
 // Configurator defines the interface for implementing a Helm Configuration
@@ -32,15 +38,101 @@ type Configurator interface {
 
 // Configuration defines a struct for the .helm.yaml file
 type Configuration struct {
-	Chart               string `yaml:"chart"`
-	ChartVersion        string `yaml:"chartVersion"`
-	HelmYaml            string
-	ValuesYaml          string
-	PostRenderBinary    string `yaml:"postRenderBinary"`
-	KeyValueAssignments map[string]string
+	Chart                 string               `yaml:"chart"`
+	ChartVersion          string               `yaml:"chartVersion"`
+	HelmYaml              string               `yaml:"-"`
+	ValuesYaml            string               `yaml:"-"`
+	PostRenderBinary      string               `yaml:"postRenderBinary"`
+	ValuesFiles           []string             `yaml:"valuesFiles"`
+	ClusterScopedKinds    []string             `yaml:"clusterScopedKinds"`
+	APIResourcesFile      string               `yaml:"apiResourcesFile"`
+	CreateNamespace       *bool                `yaml:"createNamespace"`
+	NamespaceLabels       map[string]string    `yaml:"namespaceLabels"`
+	NamespaceAnnotations  map[string]string    `yaml:"namespaceAnnotations"`
+	FluxIgnoreAnnotation  *bool                `yaml:"fluxIgnoreAnnotation"`
+	Offline               bool                 `yaml:"offline"`
+	KubeVersion           string               `yaml:"kubeVersion"`
+	APIVersions           []string             `yaml:"apiVersions"`
+	APIVersionsFile       string               `yaml:"apiVersionsFile"`
+	Repository            string               `yaml:"repository"`
+	UsernameEnv           string               `yaml:"usernameEnv"`
+	PasswordEnv           string               `yaml:"passwordEnv"`
+	CaFile                string               `yaml:"caFile"`
+	InsecureSkipTLSVerify bool                 `yaml:"insecureSkipTLSVerify"`
+	DependencyUpdate      bool                 `yaml:"dependencyUpdate"`
+	Verify                bool                 `yaml:"verify"`
+	Keyring               string               `yaml:"keyring"`
+	ReleaseName           string               `yaml:"releaseName"`
+	Namespace             string               `yaml:"namespace"`
+	ReleaseNameKey        string               `yaml:"releaseNameKey"`
+	NamespaceKey          string               `yaml:"namespaceKey"`
+	KeyValueAssignments   *KeyValueAssignments `yaml:"-"`
+	ChartCache            *ChartCache          `yaml:"-"`
+	Lock                  *Lock                `yaml:"-"`
+	// Strict makes unknown keys on .helm.yaml an error
+	Strict bool `yaml:"-"`
+	// Sources tells where the keys were set, by their name on .helm.yaml
+	Sources map[string]string `yaml:"-"`
 }
 
-func addNamespaceMetadata(manifests []map[string]interface{}, namespace string) ([]map[string]interface{}, error) {
+// DefaultClusterScopedKinds lists the built-in Kubernetes kinds that are not namespaced
+var DefaultClusterScopedKinds = []string{
+	"APIService",
+	"CSIDriver",
+	"CSINode",
+	"CertificateSigningRequest",
+	"ClusterRole",
+	"ClusterRoleBinding",
+	"ComponentStatus",
+	"CustomResourceDefinition",
+	"FlowSchema",
+	"IngressClass",
+	"MutatingWebhookConfiguration",
+	"Namespace",
+	"Node",
+	"PersistentVolume",
+	"PodSecurityPolicy",
+	"PriorityClass",
+	"PriorityLevelConfiguration",
+	"RuntimeClass",
+	"SelfSubjectAccessReview",
+	"SelfSubjectRulesReview",
+	"StorageClass",
+	"SubjectAccessReview",
+	"TokenReview",
+	"ValidatingWebhookConfiguration",
+	"VolumeAttachment",
+}
+
+// clusterScopedKinds builds the set of kinds that must not have a namespace, starting
+// from DefaultClusterScopedKinds, then applying the APIResourcesFile and finally
+// adding the ClusterScopedKinds
+func (h *Configuration) clusterScopedKinds() (map[string]bool, error) {
+	kinds := make(map[string]bool)
+	for _, kind := range DefaultClusterScopedKinds {
+		kinds[kind] = true
+	}
+	if h.APIResourcesFile != "" {
+		file, err := os.Open(h.APIResourcesFile)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading API resources file: %w", err)
+		}
+		defer file.Close()
+		resources, err := util.ParseAPIResources(file)
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing API resources file %s: %w", h.APIResourcesFile, err)
+		}
+		for kind, namespaced := range resources {
+			kinds[kind] = !namespaced
+		}
+	}
+	for _, kind := range h.ClusterScopedKinds {
+		kinds[kind] = true
+	}
+	return kinds, nil
+}
+
+func addNamespaceMetadata(manifests []map[string]interface{}, namespace string, clusterScopedKinds map[string]bool) ([]map[string]interface{}, error) {
 	if len(manifests) == 0 {
 		return nil, fmt.Errorf("Empty manifest list")
 	}
@@ -49,6 +141,9 @@ func addNamespaceMetadata(manifests []map[string]interface{}, namespace string)
 		if len(manifest) == 0 {
 			continue
 		}
+		if kind, ok := manifest["kind"].(string); ok && clusterScopedKinds[kind] {
+			continue
+		}
 		_, err := util.NestedMapLookup(manifest, "metadata")
 		if err == nil {
 			manifest["metadata"].(map[interface{}]interface{})["namespace"] = namespace
@@ -68,7 +163,15 @@ func (h *Configuration) getConf(file io.Reader) error {
 	if err != nil {
 		return fmt.Errorf("Error reading IO buffer: %w", err)
 	}
-	err = yaml.Unmarshal(buffer, h)
+	verify, offline := h.Verify, h.Offline
+	if h.Strict {
+		err = yaml.UnmarshalStrict(buffer, h)
+	} else {
+		err = yaml.Unmarshal(buffer, h)
+	}
+	// Verification and offline mode can be turned on by a .helm.yaml, but never off
+	h.Verify = h.Verify || verify
+	h.Offline = h.Offline || offline
 	if err != nil {
 		return fmt.Errorf("An error occured unmarshaling the file contents into a YAML struct: %s", err)
 	}
@@ -92,19 +195,167 @@ func (h *Configuration) BuildHelmConfig(file io.Reader) error {
 	return nil
 }
 
+// BuildHelmConfigFromPath overrides the values of the Conf based on every .helm.yaml
+// file found from rootPath down to path, so keys from the nearest folder take
+// precedence over the ones inherited from its parents.
+// If no .helm.yaml is found, it checks if all required attributes are set.
+func (h *Configuration) BuildHelmConfigFromPath(rootPath string, path string) error {
+	found := false
+	for _, dir := range ancestorDirs(rootPath, path) {
+		applied, err := h.applyHelmYaml(dir)
+		if err != nil {
+			return err
+		}
+		found = found || applied
+	}
+	if !found {
+		return h.BuildHelmConfig(nil)
+	}
+	return nil
+}
+
+// applyHelmYaml overrides the values of the Conf with the .helm.yaml on dir, if there
+// is one. Even if some keys are invalid, the valid ones are still applied.
+func (h *Configuration) applyHelmYaml(dir string) (bool, error) {
+	file := filepath.Join(dir, h.HelmYaml)
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	confErr := h.getConf(bytes.NewReader(data))
+	// Parse the file alone to find out which paths and keys it sets
+	layer := &Configuration{}
+	//nolint:errcheck
+	yaml.Unmarshal(data, layer)
+	h.resolvePaths(layer, dir)
+	keys := map[string]interface{}{}
+	//nolint:errcheck
+	yaml.Unmarshal(data, &keys)
+	for key := range keys {
+		h.SetSource(key, file)
+	}
+	if confErr != nil {
+		return true, fmt.Errorf("%s: %w", file, confErr)
+	}
+	return true, nil
+}
+
+// SetSource records where key, as named on .helm.yaml, was set
+func (h *Configuration) SetSource(key string, source string) {
+	if h.Sources == nil {
+		h.Sources = map[string]string{}
+	}
+	h.Sources[key] = source
+}
+
+// fileScheme explicitly marks a chart as a local path
+const fileScheme = "file://"
+
+// resolvePaths sets the paths configured by layer, a .helm.yaml on dir, relative to dir
+func (h *Configuration) resolvePaths(layer *Configuration, dir string) {
+	if layer.Chart != "" {
+		h.Chart = resolveChartPath(dir, layer.Chart)
+	}
+	if strings.ContainsRune(layer.PostRenderBinary, filepath.Separator) {
+		h.PostRenderBinary = resolvePath(dir, layer.PostRenderBinary)
+	}
+	if layer.ValuesFiles != nil {
+		h.ValuesFiles = make([]string, 0, len(layer.ValuesFiles))
+		for _, file := range layer.ValuesFiles {
+			h.ValuesFiles = append(h.ValuesFiles, resolvePath(dir, file))
+		}
+	}
+	if layer.APIResourcesFile != "" {
+		h.APIResourcesFile = resolvePath(dir, layer.APIResourcesFile)
+	}
+	if layer.APIVersionsFile != "" {
+		h.APIVersionsFile = resolvePath(dir, layer.APIVersionsFile)
+	}
+	if layer.CaFile != "" {
+		h.CaFile = resolvePath(dir, layer.CaFile)
+	}
+	if layer.Keyring != "" {
+		h.Keyring = resolvePath(dir, layer.Keyring)
+	}
+}
+
+// resolvePath resolves a relative path from dir
+func resolvePath(dir string, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// resolveChartPath resolves chart from dir if it's a local path: when it has the
+// file:// scheme, starts with . or /, or exists relative to dir. Otherwise chart is
+// a repository or registry reference and is returned as is.
+func resolveChartPath(dir string, chart string) string {
+	if strings.HasPrefix(chart, fileScheme) {
+		return resolvePath(dir, strings.TrimPrefix(chart, fileScheme))
+	}
+	if strings.HasPrefix(chart, ".") || filepath.IsAbs(chart) {
+		return resolvePath(dir, chart)
+	}
+	if _, err := os.Stat(filepath.Join(dir, chart)); err == nil {
+		return filepath.Join(dir, chart)
+	}
+	return chart
+}
+
+// ancestorDirs lists the folders from rootPath down to path, both included.
+// If path is not inside rootPath, only path is returned.
+func ancestorDirs(rootPath string, path string) []string {
+	rootPath = filepath.Clean(rootPath)
+	path = filepath.Clean(path)
+	// Relative and absolute paths can only be compared once both are absolute
+	if filepath.IsAbs(rootPath) != filepath.IsAbs(path) {
+		absRoot, rootErr := filepath.Abs(rootPath)
+		absPath, pathErr := filepath.Abs(path)
+		if rootErr == nil && pathErr == nil {
+			rootPath, path = absRoot, absPath
+		}
+	}
+	rel, err := filepath.Rel(rootPath, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return []string{path}
+	}
+	dirs := []string{rootPath}
+	if rel == "." {
+		return dirs
+	}
+	dir := rootPath
+	for _, elem := range strings.Split(rel, string(filepath.Separator)) {
+		dir = filepath.Join(dir, elem)
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
 func (h *Configuration) buildHelmClient(name string, namespace string) (*action.Install, error) {
+	capabilities, err := h.getCapabilities()
+	if err != nil {
+		return nil, err
+	}
 	settings := cli.New()
 	actionConfig := new(action.Configuration)
 	//nolint:errcheck
 	actionConfig.Init(settings.RESTClientGetter(), namespace, os.Getenv("HELM_DRIVER"), log.Printf)
-        actionConfig.Capabilities = getCapabilities()
+	actionConfig.Capabilities = capabilities
+	actionConfig.RegistryClient, err = newRegistryClient(settings)
+	if err != nil {
+		return nil, err
+	}
 	client := action.NewInstall(actionConfig)
 	client.ReleaseName = name
 	client.Namespace = namespace
 	client.DryRun = true
 	client.ClientOnly = true
 	client.UseReleaseName = true
-        client.KubeVersion = &actionConfig.Capabilities.KubeVersion
+	client.KubeVersion = &capabilities.KubeVersion
+	client.APIVersions = capabilities.APIVersions
 	if h.PostRenderBinary != "" {
 		pe, err := postrender.NewExec(h.PostRenderBinary)
 		if err != nil {
@@ -117,26 +368,135 @@ func (h *Configuration) buildHelmClient(name string, namespace string) (*action.
 }
 
 func (h *Configuration) loadChart(client *action.Install) (*chart.Chart, error) {
-	settings := cli.New()
-	client.ChartPathOptions.Version = h.ChartVersion
-	cp, err := client.ChartPathOptions.LocateChart(h.Chart, settings)
+	version := h.ChartVersion
+	var locked *LockedChart
+	if h.Lock != nil {
+		if locked = h.Lock.find(h.Chart, h.Repository, h.ChartVersion); locked == nil {
+			return nil, fmt.Errorf("Chart %s version %q is not on the lock file", h.Chart, h.ChartVersion)
+		}
+		version = locked.Version
+	}
+	if err := h.setChartPathOptions(&client.ChartPathOptions); err != nil {
+		return nil, err
+	}
+	client.ChartPathOptions.Version = version
+	locate := func() (string, error) {
+		cp, err := client.ChartPathOptions.LocateChart(h.Chart, cli.New())
+		if err != nil {
+			return "", fmt.Errorf("Unable to locate chart: %s", err)
+		}
+		if h.DependencyUpdate {
+			if err := updateDependencies(cp); err != nil {
+				return "", err
+			}
+		}
+		return cp, nil
+	}
+	check := func(path string) error {
+		if locked == nil {
+			return nil
+		}
+		return locked.check(path)
+	}
+	var chartRequested *chart.Chart
+	var err error
+	if h.ChartCache != nil {
+		key := chartKey{
+			repository:       h.Repository,
+			chart:            h.Chart,
+			version:          version,
+			verify:           h.Verify,
+			dependencyUpdate: h.DependencyUpdate,
+		}
+		if h.Verify {
+			key.keyring = h.Keyring
+		}
+		chartRequested, err = h.ChartCache.get(key, locate, check)
+	} else {
+		chartRequested, err = loadLocatedChart(locate, check)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if dependencies := chartRequested.Metadata.Dependencies; dependencies != nil {
+		if err := action.CheckDependencies(chartRequested, dependencies); err != nil {
+			return nil, fmt.Errorf("Chart %s has missing dependencies, they can be downloaded with dependencyUpdate: %w", h.Chart, err)
+		}
+	}
+	return chartRequested, nil
+}
+
+func loadLocatedChart(locate func() (string, error), check func(path string) error) (*chart.Chart, error) {
+	cp, err := locate()
 	if err != nil {
-		return nil, fmt.Errorf("Unable to locate chart: %s", err)
+		return nil, err
+	}
+	if err := check(cp); err != nil {
+		return nil, err
 	}
 	return loader.Load(cp)
 }
 
+// Default values keys holding the release name and namespace
+const (
+	DefaultReleaseNameKey = "releaseName"
+	DefaultNamespaceKey   = "namespace"
+)
+
+// InvalidValueError is returned when the value holding the release name or namespace
+// is not a non-empty string
+type InvalidValueError struct {
+	Key   string
+	Value interface{}
+}
+
+func (e *InvalidValueError) Error() string {
+	return fmt.Sprintf("Value %s must be a non-empty string, got %T %v", e.Key, e.Value, e.Value)
+}
+
+// releaseNameKey returns the dotted path of the values key holding the release name
+func (h *Configuration) releaseNameKey() string {
+	if h.ReleaseNameKey == "" {
+		return DefaultReleaseNameKey
+	}
+	return h.ReleaseNameKey
+}
+
+// namespaceKey returns the dotted path of the values key holding the namespace
+func (h *Configuration) namespaceKey() string {
+	if h.NamespaceKey == "" {
+		return DefaultNamespaceKey
+	}
+	return h.NamespaceKey
+}
+
+// ReleaseIdentity returns the release name and namespace defined on the values, under
+// the releaseNameKey and namespaceKey. A missing key is reported as an
+// util.MissingFieldsError and a value that is not a string as an InvalidValueError.
+func (h *Configuration) ReleaseIdentity(vals chartutil.Values) (string, string, error) {
+	nameKey, namespaceKey := h.releaseNameKey(), h.namespaceKey()
+	values, err := util.ValidateValues(vals, nameKey, namespaceKey)
+	if err != nil {
+		return "", "", err
+	}
+	name, ok := values[nameKey].(string)
+	if !ok || name == "" {
+		return "", "", &InvalidValueError{Key: nameKey, Value: values[nameKey]}
+	}
+	namespace, ok := values[namespaceKey].(string)
+	if !ok || namespace == "" {
+		return "", "", &InvalidValueError{Key: namespaceKey, Value: values[namespaceKey]}
+	}
+	return name, namespace, nil
+}
+
 // InstallChart uses the Helm sdk and Conf values to generate the Chart manifests
 func (h *Configuration) InstallChart(vals chartutil.Values) ([]map[string]interface{}, error) {
-	// Validate chart
-	values, err := util.ValidateValues(vals, "releaseName", "namespace")
+	name, namespace, err := h.ReleaseIdentity(vals)
 	if err != nil {
 		return nil, err
 	}
 
-	name := values["releaseName"].(string)
-	namespace := values["namespace"].(string)
-
 	// template helm chart
 	client, err := h.buildHelmClient(name, namespace)
 	if err != nil {
@@ -155,57 +515,173 @@ func (h *Configuration) InstallChart(vals chartutil.Values) ([]map[string]interf
 		return nil, err
 	}
 
+	clusterScopedKinds, err := h.clusterScopedKinds()
+	if err != nil {
+		return nil, err
+	}
+	manifest, err = addNamespaceMetadata(manifest, namespace, clusterScopedKinds)
+	if err != nil {
+		return nil, err
+	}
+	if h.CreateNamespace != nil && !*h.CreateNamespace {
+		return manifest, nil
+	}
+
 	// One current limitation on the way Helm Releases work is that the namespace is
 	// provided as a parameter to kubectl.
 	// Helm templates also don't generate the namespace
 	// So we're going to add a Namespace manifest
-	nsManifest := []map[string]interface{}{util.CreateNamespace(namespace, nil, nil)}
-	manifest, err = addNamespaceMetadata(manifest, namespace)
+	nsManifest := []map[string]interface{}{h.namespaceManifest(namespace)}
+	return append(nsManifest, manifest...), nil
+}
+
+// namespaceManifest generates the Namespace manifest with the configured labels and annotations
+func (h *Configuration) namespaceManifest(namespace string) map[string]interface{} {
+	annotations := make(map[string]string, len(h.NamespaceAnnotations))
+	for k, v := range h.NamespaceAnnotations {
+		annotations[k] = v
+	}
+	labels := make(map[string]string, len(h.NamespaceLabels))
+	for k, v := range h.NamespaceLabels {
+		labels[k] = v
+	}
+	if h.FluxIgnoreAnnotation != nil && !*h.FluxIgnoreAnnotation {
+		return util.NewNamespace(namespace, annotations, labels)
+	}
+	return util.CreateNamespace(namespace, annotations, labels)
+}
+
+// setChartPathOptions configures the repository the chart is fetched from, along with
+// its credentials, TLS settings and provenance verification
+func (h *Configuration) setChartPathOptions(options *action.ChartPathOptions) error {
+	username, err := credentialFromEnv(h.UsernameEnv)
+	if err != nil {
+		return err
+	}
+	password, err := credentialFromEnv(h.PasswordEnv)
+	if err != nil {
+		return err
+	}
+	options.RepoURL = h.Repository
+	options.Username = username
+	options.Password = password
+	options.CaFile = h.CaFile
+	options.InsecureSkipTLSverify = h.InsecureSkipTLSVerify
+	options.Verify = h.Verify
+	options.Keyring = h.Keyring
+	return nil
+}
+
+// credentialFromEnv reads a repository credential from the env var name, if configured
+func credentialFromEnv(name string) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("Environment variable %s with repository credentials is not set", name)
+	}
+	return value, nil
+}
+
+// newRegistryClient creates the client used to pull oci:// charts, authenticating with
+// the credentials on the Helm registry config
+func newRegistryClient(settings *cli.EnvSettings) (*registry.Client, error) {
+	client, err := registry.NewClient(
+		registry.ClientOptCredentialsFile(settings.RegistryConfig),
+		registry.ClientOptEnableCache(true),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating registry client: %w", err)
+	}
+	return client, nil
+}
+
+// getCapabilities returns the Kubernetes version and API versions the charts are
+// rendered with. The Kubernetes version is taken from the configuration, the
+// KUBE_VERSION env var or, unless running offline, the cluster on the kubeconfig.
+func (h *Configuration) getCapabilities() (*chartutil.Capabilities, error) {
+	capabilities := chartutil.DefaultCapabilities.Copy()
+
+	kubeVersion := h.KubeVersion
+	if kubeVersion == "" {
+		kubeVersion = os.Getenv("KUBE_VERSION")
+	}
+	if kubeVersion != "" {
+		version, err := chartutil.ParseKubeVersion(kubeVersion)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid kubernetes version %q: %w", kubeVersion, err)
+		}
+		capabilities.KubeVersion = *version
+	} else if !h.Offline {
+		if version := clusterKubeVersion(); version != nil {
+			capabilities.KubeVersion = *version
+		}
+	}
+
+	apiVersions, err := h.apiVersions()
 	if err != nil {
 		return nil, err
 	}
-	return append(nsManifest, manifest...), nil
+	capabilities.APIVersions = append(capabilities.APIVersions, apiVersions...)
+	return capabilities, nil
+}
+
+// apiVersions returns the APIVersions along with the ones listed on the APIVersionsFile
+func (h *Configuration) apiVersions() (chartutil.VersionSet, error) {
+	apiVersions := append(chartutil.VersionSet{}, h.APIVersions...)
+	if h.APIVersionsFile == "" {
+		return apiVersions, nil
+	}
+	file, err := os.Open(h.APIVersionsFile)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading API versions file: %w", err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		apiVersions = append(apiVersions, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Error reading API versions file: %w", err)
+	}
+	return apiVersions, nil
 }
 
-func getCapabilities() (*chartutil.Capabilities ){
-        val, present := os.LookupEnv("KUBE_VERSION")
-        if present {
-                kubeVersion, err := chartutil.ParseKubeVersion(val);
-                if err != nil {
-                       log.Println("Error : failed to parse KUBE_VERSION env var -> ", err)
-                } else {
-                       return &chartutil.Capabilities{
-                               KubeVersion: *kubeVersion,
-                               APIVersions: chartutil.DefaultVersionSet,
-                               HelmVersion: chartutil.DefaultCapabilities.HelmVersion,
-                       }
-                }
-        } else {
-          config, err := config.GetConfig()
-          if err != nil {
-              fmt.Printf("failed to get kubernetes config %v",err)
-              return chartutil.DefaultCapabilities
-          }
-          discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
-          if err != nil {
-              fmt.Printf(" error in discoveryClient %v",err)
-              return chartutil.DefaultCapabilities
-          }
-          
-          val, err := discoveryClient.ServerVersion()
-          if err != nil{
-              fmt.Println("Error while fetching server version information", err)
-              return chartutil.DefaultCapabilities
-          }
-          kubeVersion, err := chartutil.ParseKubeVersion(val.String());
-          if err != nil {
-                 log.Println("Error : failed to parse KUBE_VERSION env var -> ", err)
-          }
-          return &chartutil.Capabilities{
-                  KubeVersion: *kubeVersion,
-                  APIVersions: chartutil.DefaultVersionSet,
-                  HelmVersion: chartutil.DefaultCapabilities.HelmVersion,
-          }
-        }
-        return chartutil.DefaultCapabilities
+var (
+	clusterVersionOnce sync.Once
+	clusterVersion     *chartutil.KubeVersion
+)
+
+// clusterKubeVersion discovers the version of the cluster on the kubeconfig. The
+// cluster is only contacted once, returning nil if it isn't reachable.
+func clusterKubeVersion() *chartutil.KubeVersion {
+	clusterVersionOnce.Do(func() {
+		config, err := config.GetConfig()
+		if err != nil {
+			log.Printf("failed to get kubernetes config, using the default kubernetes version: %v", err)
+			return
+		}
+		discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+		if err != nil {
+			log.Printf("failed to create discovery client, using the default kubernetes version: %v", err)
+			return
+		}
+		info, err := discoveryClient.ServerVersion()
+		if err != nil {
+			log.Printf("failed to fetch server version, using the default kubernetes version: %v", err)
+			return
+		}
+		version, err := chartutil.ParseKubeVersion(info.String())
+		if err != nil {
+			log.Printf("failed to parse server version, using the default kubernetes version: %v", err)
+			return
+		}
+		clusterVersion = version
+	})
+	return clusterVersion
 }
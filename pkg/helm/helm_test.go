@@ -1,19 +1,28 @@
 package helm
 
 import (
+	"bytes"
+	"encoding/pem"
 	"fmt"
 	"io"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/topfreegames/helm-generate/pkg/util"
+	"golang.org/x/crypto/openpgp" //nolint
 	"helm.sh/helm/v3/pkg/action"
 	"helm.sh/helm/v3/pkg/chart"
 	"helm.sh/helm/v3/pkg/chartutil"
 	"helm.sh/helm/v3/pkg/cli"
 	"helm.sh/helm/v3/pkg/postrender"
+	"helm.sh/helm/v3/pkg/provenance"
+	"helm.sh/helm/v3/pkg/repo"
 )
 
 type TestCase struct {
@@ -328,9 +337,61 @@ func TestInstallChart(t *testing.T) {
 	}
 }
 
+func TestReleaseIdentity(t *testing.T) {
+	tests := []TestCase{
+		{
+			Name:     "default keys",
+			Sample:   []interface{}{Configuration{}, chartutil.Values{"releaseName": "app", "namespace": "ns"}},
+			Expected: ReturnWithError{Value: []string{"app", "ns"}},
+		},
+		{
+			Name: "nested keys",
+			Sample: []interface{}{
+				Configuration{ReleaseNameKey: "release.name", NamespaceKey: "global.namespace"},
+				chartutil.Values{
+					"release": map[string]interface{}{"name": "app"},
+					"global":  map[string]interface{}{"namespace": "ns"},
+				},
+			},
+			Expected: ReturnWithError{Value: []string{"app", "ns"}},
+		},
+		{
+			Name:     "missing namespace",
+			Sample:   []interface{}{Configuration{}, chartutil.Values{"releaseName": "app"}},
+			Expected: ReturnWithError{Value: &util.MissingFieldsError{}, Error: true},
+		},
+		{
+			Name:     "namespace is not a string",
+			Sample:   []interface{}{Configuration{}, chartutil.Values{"releaseName": "app", "namespace": 123}},
+			Expected: ReturnWithError{Value: &InvalidValueError{}, Error: true},
+		},
+		{
+			Name:     "empty release name",
+			Sample:   []interface{}{Configuration{}, chartutil.Values{"releaseName": "", "namespace": "ns"}},
+			Expected: ReturnWithError{Value: &InvalidValueError{}, Error: true},
+		},
+	}
+	for i, test := range tests {
+		t.Logf("Test case %d: %s", i, test.Name)
+		sample := test.Sample.([]interface{})
+		expected := test.Expected.(ReturnWithError)
+		h := sample[0].(Configuration)
+
+		name, namespace, err := h.ReleaseIdentity(sample[1].(chartutil.Values))
+		if expected.Error {
+			assert.Error(t, err, "should return an error")
+			assert.IsType(t, expected.Value, err, "should return a typed error")
+		} else {
+			assert.Nil(t, err, "should not return error")
+			assert.Equal(t, expected.Value, []string{name, namespace}, "release identity should match")
+		}
+	}
+}
+
 func TestAddNamespaceMetadata(t *testing.T) {
 	emptyMap := map[string]interface{}{}
 	namespace := "test-namespace"
+	clusterScopedKinds := map[string]bool{"ClusterRole": true, "Namespace": true}
 	tests := []TestCase{
 		{
 			Name: "manifest with no namespace",
@@ -374,6 +435,51 @@ func TestAddNamespaceMetadata(t *testing.T) {
 				Error: false,
 			},
 		},
+		{
+			Name: "cluster-scoped manifest",
+			Sample: []map[string]interface{}{
+				{
+					"kind": "ClusterRole",
+					"metadata": map[interface{}]interface{}{
+						"name": "test-manifest",
+					},
+				},
+			},
+			Expected: ReturnWithError{
+				Value: []map[string]interface{}{
+					{
+						"kind": "ClusterRole",
+						"metadata": map[interface{}]interface{}{
+							"name": "test-manifest",
+						},
+					},
+				},
+				Error: false,
+			},
+		},
+		{
+			Name: "namespaced manifest with kind",
+			Sample: []map[string]interface{}{
+				{
+					"kind": "Role",
+					"metadata": map[interface{}]interface{}{
+						"name": "test-manifest",
+					},
+				},
+			},
+			Expected: ReturnWithError{
+				Value: []map[string]interface{}{
+					{
+						"kind": "Role",
+						"metadata": map[interface{}]interface{}{
+							"name":      "test-manifest",
+							"namespace": namespace,
+						},
+					},
+				},
+				Error: false,
+			},
+		},
 		{
 			Name: "manifest with different namespace",
 			Sample: []map[string]interface{}{
@@ -404,7 +510,7 @@ func TestAddNamespaceMetadata(t *testing.T) {
 		expected := test.Expected.(ReturnWithError)
 		sample := test.Sample.([]map[string]interface{})
 
-		val, err := addNamespaceMetadata(sample, namespace)
+		val, err := addNamespaceMetadata(sample, namespace, clusterScopedKinds)
 
 		if expected.Error {
 			assert.Error(t, err, "should return an error")
@@ -470,3 +576,471 @@ func TestLoadChart(t *testing.T) {
 		}
 	}
 }
+
+func TestAncestorDirs(t *testing.T) {
+	tests := []TestCase{
+		{
+			Name:     "nested folder",
+			Sample:   []string{"root", "root/team/app/"},
+			Expected: []string{"root", "root/team", "root/team/app"},
+		},
+		{
+			Name:     "root folder",
+			Sample:   []string{"./root/", "root"},
+			Expected: []string{"root"},
+		},
+		{
+			Name:     "current folder as root",
+			Sample:   []string{".", "app"},
+			Expected: []string{".", "app"},
+		},
+		{
+			Name:     "folder outside root",
+			Sample:   []string{"root", "other/app"},
+			Expected: []string{"other/app"},
+		},
+	}
+	for i, test := range tests {
+		t.Logf("Test case %d: %s", i, test.Name)
+		sample := test.Sample.([]string)
+		assert.Equal(t, test.Expected, ancestorDirs(sample[0], sample[1]), "should list folders from root to path")
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{wd, filepath.Join(wd, "app")}, ancestorDirs(wd, "app"), "should compare absolute and relative paths")
+}
+
+func TestGetCapabilities(t *testing.T) {
+	apiVersionsFile, err := os.CreateTemp(t.TempDir(), "api-versions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	//nolint:errcheck
+	apiVersionsFile.WriteString("# kubectl api-versions\napps/v1\n\n  cert-manager.io/v1  \n")
+	apiVersionsFile.Close()
+
+	tests := []TestCase{
+		{
+			Name:     "offline defaults",
+			Sample:   Configuration{Offline: true},
+			Expected: ReturnWithError{Value: []string{chartutil.DefaultCapabilities.KubeVersion.Version}},
+		},
+		{
+			Name:     "kube version and api versions",
+			Sample:   Configuration{KubeVersion: "1.25.3", APIVersions: []string{"monitoring.coreos.com/v1"}},
+			Expected: ReturnWithError{Value: []string{"v1.25.3", "monitoring.coreos.com/v1"}},
+		},
+		{
+			Name:     "api versions file",
+			Sample:   Configuration{Offline: true, APIVersionsFile: apiVersionsFile.Name()},
+			Expected: ReturnWithError{Value: []string{chartutil.DefaultCapabilities.KubeVersion.Version, "apps/v1", "cert-manager.io/v1"}},
+		},
+		{
+			Name:     "invalid kube version",
+			Sample:   Configuration{KubeVersion: "not-a-version"},
+			Expected: ReturnWithError{Error: true},
+		},
+		{
+			Name:     "non-existent api versions file",
+			Sample:   Configuration{Offline: true, APIVersionsFile: "i don't exist"},
+			Expected: ReturnWithError{Error: true},
+		},
+	}
+	for i, test := range tests {
+		t.Logf("Test case %d: %s", i, test.Name)
+		h := test.Sample.(Configuration)
+		expected := test.Expected.(ReturnWithError)
+		capabilities, err := h.getCapabilities()
+		if expected.Error {
+			assert.Error(t, err, "should return an error")
+			continue
+		}
+		assert.Nil(t, err, "should not return error")
+		versions := expected.Value.([]string)
+		assert.Equal(t, versions[0], capabilities.KubeVersion.Version, "should use the expected kubernetes version")
+		for _, apiVersion := range versions[1:] {
+			assert.True(t, capabilities.APIVersions.Has(apiVersion), "should have api version %s", apiVersion)
+		}
+		assert.True(t, capabilities.APIVersions.Has("v1"), "should keep the default api versions")
+	}
+}
+
+func TestGetCapabilitiesFromEnv(t *testing.T) {
+	t.Setenv("KUBE_VERSION", "v1.24.0")
+	h := Configuration{}
+	capabilities, err := h.getCapabilities()
+	assert.Nil(t, err, "should not return error")
+	assert.Equal(t, "v1.24.0", capabilities.KubeVersion.Version, "should use KUBE_VERSION")
+
+	h.KubeVersion = "v1.26.1"
+	capabilities, err = h.getCapabilities()
+	assert.Nil(t, err, "should not return error")
+	assert.Equal(t, "v1.26.1", capabilities.KubeVersion.Version, "configured version should take precedence over KUBE_VERSION")
+}
+
+// newTestRepository serves the given charts as a chart repository, requiring basic
+// auth when username is set
+func newTestRepository(t *testing.T, tls bool, username string, password string, charts ...*chart.Chart) *httptest.Server {
+	dir := t.TempDir()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); username != "" && (!ok || user != username || pass != password) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		http.FileServer(http.Dir(dir)).ServeHTTP(w, r)
+	})
+	var server *httptest.Server
+	if tls {
+		server = httptest.NewTLSServer(handler)
+	} else {
+		server = httptest.NewServer(handler)
+	}
+	t.Cleanup(server.Close)
+
+	index := repo.NewIndexFile()
+	for _, c := range charts {
+		archive, err := chartutil.Save(c, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		digest, err := provenance.DigestFile(archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		index.MustAdd(c.Metadata, filepath.Base(archive), server.URL, digest)
+	}
+	if err := index.WriteFile(filepath.Join(dir, "index.yaml"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return server
+}
+
+func TestLoadChartRepository(t *testing.T) {
+	cache := t.TempDir()
+	t.Setenv("HELM_REPOSITORY_CACHE", cache)
+	t.Setenv("HELM_REPOSITORY_CONFIG", filepath.Join(cache, "repositories.yaml"))
+	t.Setenv("TEST_REPOSITORY_USERNAME", "user")
+	t.Setenv("TEST_REPOSITORY_PASSWORD", "secret")
+	t.Setenv("TEST_REPOSITORY_WRONG_PASSWORD", "wrong")
+
+	newChart := newCachedChart()
+	newChart.Metadata.Version = "1.1.0"
+	server := newTestRepository(t, false, "user", "secret", newCachedChart(), newChart)
+	tlsServer := newTestRepository(t, true, "", "", newCachedChart())
+	caFile := filepath.Join(cache, "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tlsServer.Certificate().Raw})
+	if err := os.WriteFile(caFile, ca, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []TestCase{
+		{
+			Name: "repository with credentials",
+			Sample: Configuration{
+				Chart: "cached", ChartVersion: "~1.0.0", Repository: server.URL,
+				UsernameEnv: "TEST_REPOSITORY_USERNAME", PasswordEnv: "TEST_REPOSITORY_PASSWORD",
+			},
+			Expected: ReturnWithError{Value: "1.0.0"},
+		},
+		{
+			Name: "latest version",
+			Sample: Configuration{
+				Chart: "cached", Repository: server.URL,
+				UsernameEnv: "TEST_REPOSITORY_USERNAME", PasswordEnv: "TEST_REPOSITORY_PASSWORD",
+			},
+			Expected: ReturnWithError{Value: "1.1.0"},
+		},
+		{
+			Name: "wrong credentials",
+			Sample: Configuration{
+				Chart: "cached", ChartVersion: "1.0.0", Repository: server.URL,
+				UsernameEnv: "TEST_REPOSITORY_USERNAME", PasswordEnv: "TEST_REPOSITORY_WRONG_PASSWORD",
+			},
+			Expected: ReturnWithError{Error: true},
+		},
+		{
+			Name: "unset credentials env var",
+			Sample: Configuration{
+				Chart: "cached", ChartVersion: "1.0.0", Repository: server.URL,
+				UsernameEnv: "TEST_REPOSITORY_UNSET", PasswordEnv: "TEST_REPOSITORY_PASSWORD",
+			},
+			Expected: ReturnWithError{Error: true},
+		},
+		{
+			Name:     "tls repository with ca file",
+			Sample:   Configuration{Chart: "cached", ChartVersion: "1.0.0", Repository: tlsServer.URL, CaFile: caFile},
+			Expected: ReturnWithError{Value: "1.0.0"},
+		},
+		{
+			Name:     "tls repository skipping verification",
+			Sample:   Configuration{Chart: "cached", ChartVersion: "1.0.0", Repository: tlsServer.URL, InsecureSkipTLSVerify: true},
+			Expected: ReturnWithError{Value: "1.0.0"},
+		},
+		{
+			Name:     "untrusted tls repository",
+			Sample:   Configuration{Chart: "cached", ChartVersion: "1.0.0", Repository: tlsServer.URL},
+			Expected: ReturnWithError{Error: true},
+		},
+	}
+	for i, test := range tests {
+		t.Logf("Test case %d: %s", i, test.Name)
+		h := test.Sample.(Configuration)
+		expected := test.Expected.(ReturnWithError)
+
+		c, err := h.loadChart(&action.Install{})
+		if expected.Error {
+			assert.Error(t, err, "should return an error")
+			continue
+		}
+		assert.Nil(t, err, "should not return error")
+		assert.Equal(t, expected.Value, c.Metadata.Version, "should fetch the resolved version")
+
+		locked, err := h.LockChart()
+		assert.Nil(t, err, "should not return error")
+		assert.Equal(t, h.Repository, locked.Repository, "should lock the repository")
+	}
+}
+
+func TestResolveChartPath(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "my-chart"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	tests := []TestCase{
+		{
+			Name:     "relative path",
+			Sample:   "../charts/app",
+			Expected: filepath.Join(filepath.Dir(dir), "charts/app"),
+		},
+		{
+			Name:     "file scheme",
+			Sample:   "file://charts/app",
+			Expected: filepath.Join(dir, "charts/app"),
+		},
+		{
+			Name:     "absolute path",
+			Sample:   "/charts/app",
+			Expected: "/charts/app",
+		},
+		{
+			Name:     "existing folder",
+			Sample:   "my-chart",
+			Expected: filepath.Join(dir, "my-chart"),
+		},
+		{
+			Name:     "repository reference",
+			Sample:   "repository/chart-name",
+			Expected: "repository/chart-name",
+		},
+		{
+			Name:     "registry reference",
+			Sample:   "oci://registry/charts/app",
+			Expected: "oci://registry/charts/app",
+		},
+	}
+	for i, test := range tests {
+		t.Logf("Test case %d: %s", i, test.Name)
+		assert.Equal(t, test.Expected, resolveChartPath(dir, test.Sample.(string)), "should resolve the chart from the .helm.yaml folder")
+	}
+}
+
+func TestBuildHelmConfigFromPathResolvesPaths(t *testing.T) {
+	root := t.TempDir()
+	app := filepath.Join(root, "team", "app")
+	if err := os.MkdirAll(app, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		filepath.Join(root, ".helm.yaml"): `
+chart: ./charts/app
+chartVersion: 1.0.0
+postRenderBinary: ./bin/post-render
+valuesFiles:
+  - common.yaml
+apiVersionsFile: api-versions.txt
+`,
+		filepath.Join(app, ".helm.yaml"): `
+postRenderBinary: kustomize
+caFile: ../ca.pem
+`,
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := Configuration{HelmYaml: ".helm.yaml", Chart: "./default-chart", APIResourcesFile: "api-resources.txt"}
+	assert.Nil(t, h.BuildHelmConfigFromPath(root, app), "should not return error")
+	assert.Equal(t, filepath.Join(root, "charts/app"), h.Chart, "chart should be relative to the .helm.yaml setting it")
+	assert.Equal(t, "kustomize", h.PostRenderBinary, "binaries on the PATH should not be resolved")
+	assert.Equal(t, []string{filepath.Join(root, "common.yaml")}, h.ValuesFiles, "values files should be relative to the .helm.yaml setting them")
+	assert.Equal(t, filepath.Join(root, "api-versions.txt"), h.APIVersionsFile, "api versions file should be relative to the .helm.yaml setting it")
+	assert.Equal(t, filepath.Join(root, "team", "ca.pem"), h.CaFile, "ca file should be relative to the .helm.yaml setting it")
+	assert.Equal(t, "api-resources.txt", h.APIResourcesFile, "paths set by flags should not be resolved")
+
+	h = Configuration{HelmYaml: ".helm.yaml"}
+	assert.Nil(t, h.BuildHelmConfigFromPath(app, app), "should not return error")
+	assert.Equal(t, filepath.Join(app, "../ca.pem"), h.CaFile, "ca file should be relative to the .helm.yaml setting it")
+}
+
+// writeKeyrings generates a signing key, returning its private and public keyrings
+func writeKeyrings(t *testing.T, name string) (string, string) {
+	dir := t.TempDir()
+	entity, err := openpgp.NewEntity(name, "", name+"@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var private, public bytes.Buffer
+	if err := entity.SerializePrivate(&private, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := entity.Serialize(&public); err != nil {
+		t.Fatal(err)
+	}
+	privatePath := filepath.Join(dir, "secring.gpg")
+	publicPath := filepath.Join(dir, "pubring.gpg")
+	if err := os.WriteFile(privatePath, private.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(publicPath, public.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return privatePath, publicPath
+}
+
+// writeSignedChart packages a chart signed with the private keyring
+func writeSignedChart(t *testing.T, privateKeyring string, name string) string {
+	archive, err := chartutil.Save(newCachedChart(), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := provenance.NewFromKeyring(privateKeyring, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := signer.ClearSign(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(archive+".prov", []byte(signature), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return archive
+}
+
+func TestLoadChartVerify(t *testing.T) {
+	privateKeyring, publicKeyring := writeKeyrings(t, "helm-generate")
+	_, otherKeyring := writeKeyrings(t, "other")
+
+	signed := writeSignedChart(t, privateKeyring, "helm-generate")
+	unsigned, err := chartutil.Save(newCachedChart(), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := writeSignedChart(t, privateKeyring, "helm-generate")
+	tamperedChart := newCachedChart()
+	tamperedChart.Metadata.Description = "tampered"
+	if _, err := chartutil.Save(tamperedChart, filepath.Dir(tampered)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []TestCase{
+		{
+			Name:     "signed chart",
+			Sample:   Configuration{Chart: signed, Verify: true, Keyring: publicKeyring},
+			Expected: false,
+		},
+		{
+			Name:     "unsigned chart",
+			Sample:   Configuration{Chart: unsigned, Verify: true, Keyring: publicKeyring},
+			Expected: true,
+		},
+		{
+			Name:     "tampered chart",
+			Sample:   Configuration{Chart: tampered, Verify: true, Keyring: publicKeyring},
+			Expected: true,
+		},
+		{
+			Name:     "signed by unknown key",
+			Sample:   Configuration{Chart: signed, Verify: true, Keyring: otherKeyring},
+			Expected: true,
+		},
+		{
+			Name:     "unsigned chart without verification",
+			Sample:   Configuration{Chart: unsigned},
+			Expected: false,
+		},
+	}
+	for i, test := range tests {
+		t.Logf("Test case %d: %s", i, test.Name)
+		h := test.Sample.(Configuration)
+		h.ChartVersion = "1.0.0"
+		h.ChartCache = NewChartCache(t.TempDir())
+		_, err := h.loadChart(&action.Install{})
+		if test.Expected.(bool) {
+			assert.Error(t, err, "should return an error")
+		} else {
+			assert.Nil(t, err, "should not return error")
+		}
+	}
+}
+
+func TestLoadChartVerifyCached(t *testing.T) {
+	privateKeyring, publicKeyring := writeKeyrings(t, "helm-generate")
+	_, otherKeyring := writeKeyrings(t, "other")
+	signed := writeSignedChart(t, privateKeyring, "helm-generate")
+
+	chartCache := NewChartCache("")
+	h := Configuration{Chart: signed, ChartVersion: "1.0.0", Verify: true, Keyring: publicKeyring, ChartCache: chartCache}
+	_, err := h.loadChart(&action.Install{})
+	assert.Nil(t, err, "should not return error")
+
+	h = Configuration{Chart: signed, ChartVersion: "1.0.0", Verify: true, Keyring: otherKeyring, ChartCache: chartCache}
+	_, err = h.loadChart(&action.Install{})
+	assert.Error(t, err, "should verify the cached chart against every keyring")
+}
+
+func TestVerifyCantBeTurnedOff(t *testing.T) {
+	_, publicKeyring := writeKeyrings(t, "helm-generate")
+	unsigned, err := chartutil.Save(newCachedChart(), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, ".helm.yaml"), []byte("chart: "+unsigned+"\nchartVersion: 1.0.0\nverify: false\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	h := Configuration{HelmYaml: ".helm.yaml", Verify: true, Keyring: publicKeyring}
+	err = h.BuildHelmConfigFromPath(root, root)
+	assert.Nil(t, err, "should not return error")
+	assert.True(t, h.Verify, "verify: false should not turn off --verify")
+	_, err = h.loadChart(&action.Install{})
+	assert.Error(t, err, "should fail to verify the unsigned chart")
+}
+
+func TestOfflineCantBeTurnedOff(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, ".helm.yaml"), []byte("offline: false\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	sub := filepath.Join(root, "app")
+	if err := os.Mkdir(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(sub, ".helm.yaml"), []byte("offline: true\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	h := Configuration{HelmYaml: ".helm.yaml", Offline: true}
+	assert.Nil(t, h.BuildHelmConfigFromPath(root, root), "should not return error")
+	assert.True(t, h.Offline, "offline: false should not turn off --offline")
+
+	h = Configuration{HelmYaml: ".helm.yaml"}
+	assert.Nil(t, h.BuildHelmConfigFromPath(root, sub), "should not return error")
+	assert.True(t, h.Offline, "offline: true should turn on offline mode")
+}
@@ -0,0 +1,206 @@
+package helm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/cli"
+)
+
+// LockFileName is the default name of the file pinning the charts of a folder
+const LockFileName = "helm-generate.lock"
+
+// Lock pins every chart reference and version constraint used on a folder to the
+// exact chart version and contents it resolved to
+type Lock struct {
+	Charts []LockedChart `yaml:"charts"`
+}
+
+// LockedChart is the resolution of a chart reference and version constraint
+type LockedChart struct {
+	Chart      string `yaml:"chart"`
+	Repository string `yaml:"repository,omitempty"`
+	Constraint string `yaml:"constraint"`
+	Version    string `yaml:"version"`
+	Digest     string `yaml:"digest"`
+}
+
+// ReadLock reads a lock file. Local charts, stored relative to the lock file, are
+// returned as absolute paths.
+func ReadLock(path string) (*Lock, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading lock file: %w", err)
+	}
+	lock := &Lock{}
+	if err := yaml.Unmarshal(data, lock); err != nil {
+		return nil, fmt.Errorf("Error parsing lock file %s: %w", path, err)
+	}
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	for i, c := range lock.Charts {
+		if strings.HasPrefix(c.Chart, fileScheme) {
+			lock.Charts[i].Chart = filepath.Join(dir, filepath.FromSlash(strings.TrimPrefix(c.Chart, fileScheme)))
+		}
+	}
+	return lock, nil
+}
+
+// Write writes the lock file, sorting the charts so it only changes when they do.
+// Local charts are stored relative to the lock file, so it doesn't depend on the
+// folder helm-generate runs from.
+func (l *Lock) Write(path string) error {
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	for i, c := range l.Charts {
+		if local, ok := localChartPath(c.Chart, c.Repository); ok {
+			rel, err := filepath.Rel(dir, local)
+			if err != nil {
+				return err
+			}
+			l.Charts[i].Chart = fileScheme + filepath.ToSlash(rel)
+		}
+	}
+	sort.Slice(l.Charts, func(i, j int) bool {
+		if l.Charts[i].Chart != l.Charts[j].Chart {
+			return l.Charts[i].Chart < l.Charts[j].Chart
+		}
+		if l.Charts[i].Repository != l.Charts[j].Repository {
+			return l.Charts[i].Repository < l.Charts[j].Repository
+		}
+		return l.Charts[i].Constraint < l.Charts[j].Constraint
+	})
+	data, err := yaml.Marshal(l)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Has tells whether chart, repository and constraint are locked. Local charts match no
+// matter the path they are referenced by.
+func (l *Lock) Has(chart string, repository string, constraint string) bool {
+	return l.find(chart, repository, constraint) != nil
+}
+
+// find returns the resolution of chart, repository and constraint, or nil if it's not locked
+func (l *Lock) find(chart string, repository string, constraint string) *LockedChart {
+	if local, ok := localChartPath(chart, repository); ok {
+		chart = local
+	}
+	for i := range l.Charts {
+		locked := l.Charts[i].Chart
+		if local, ok := localChartPath(locked, l.Charts[i].Repository); ok {
+			locked = local
+		}
+		if locked == chart && l.Charts[i].Repository == repository && l.Charts[i].Constraint == constraint {
+			return &l.Charts[i]
+		}
+	}
+	return nil
+}
+
+// localChartPath returns the absolute path of chart if it is on the local filesystem
+func localChartPath(chart string, repository string) (string, bool) {
+	if repository != "" {
+		return "", false
+	}
+	if _, err := os.Stat(chart); err != nil {
+		return "", false
+	}
+	abs, err := filepath.Abs(chart)
+	return abs, err == nil
+}
+
+// check fails if the chart on path doesn't match the locked digest
+func (c *LockedChart) check(path string) error {
+	digest, err := chartDigest(path)
+	if err != nil {
+		return err
+	}
+	if digest != c.Digest {
+		return fmt.Errorf("Chart %s version %s has digest %s, but %s is locked", c.Chart, c.Version, digest, c.Digest)
+	}
+	return nil
+}
+
+// LockChart resolves the configured chart and version constraint
+func (h *Configuration) LockChart() (LockedChart, error) {
+	settings := cli.New()
+	registryClient, err := newRegistryClient(settings)
+	if err != nil {
+		return LockedChart{}, err
+	}
+	options := action.NewInstall(&action.Configuration{RegistryClient: registryClient}).ChartPathOptions
+	if err := h.setChartPathOptions(&options); err != nil {
+		return LockedChart{}, err
+	}
+	options.Version = h.ChartVersion
+	path, err := options.LocateChart(h.Chart, settings)
+	if err != nil {
+		return LockedChart{}, fmt.Errorf("Unable to locate chart: %s", err)
+	}
+	if h.DependencyUpdate {
+		if err := updateDependencies(path); err != nil {
+			return LockedChart{}, err
+		}
+	}
+	chartLoaded, err := loader.Load(path)
+	if err != nil {
+		return LockedChart{}, err
+	}
+	digest, err := chartDigest(path)
+	if err != nil {
+		return LockedChart{}, err
+	}
+	return LockedChart{
+		Chart:      h.Chart,
+		Repository: h.Repository,
+		Constraint: h.ChartVersion,
+		Version:    chartLoaded.Metadata.Version,
+		Digest:     digest,
+	}, nil
+}
+
+// chartDigest returns the SHA-256 digest of a chart archive or, for a chart folder,
+// of the names and contents of its files
+func chartDigest(path string) (string, error) {
+	hash := sha256.New()
+	err := filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		if file != path {
+			rel, err := filepath.Rel(path, file)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(hash, "%s\x00%d\x00", filepath.ToSlash(rel), info.Size())
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(hash, f)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("Error computing chart digest: %w", err)
+	}
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
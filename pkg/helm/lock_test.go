@@ -0,0 +1,131 @@
+package helm
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+func TestLockChart(t *testing.T) {
+	archive, err := chartutil.Save(newCachedChart(), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := Configuration{Chart: archive, ChartVersion: "1.x"}
+	locked, err := h.LockChart()
+	assert.Nil(t, err, "should not return error")
+	assert.Equal(t, LockedChart{
+		Chart:      archive,
+		Constraint: "1.x",
+		Version:    "1.0.0",
+		Digest:     fmt.Sprintf("sha256:%x", sha256.Sum256(data)),
+	}, locked, "archive digest should be its SHA-256")
+
+	h = Configuration{Chart: "tests/chart", ChartVersion: "0.1.0"}
+	locked, err = h.LockChart()
+	assert.Nil(t, err, "should not return error")
+	assert.Equal(t, "0.1.0", locked.Version, "should lock the chart version")
+	again, err := h.LockChart()
+	assert.Nil(t, err, "should not return error")
+	assert.Equal(t, locked.Digest, again.Digest, "folder digest should be stable")
+
+	h = Configuration{Chart: "invalid-chart", ChartVersion: "9"}
+	_, err = h.LockChart()
+	assert.Error(t, err, "should return an error")
+}
+
+func TestLockReadWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), LockFileName)
+	lock := &Lock{Charts: []LockedChart{
+		{Chart: "repo/b", Constraint: "1.x", Version: "1.2.0", Digest: "sha256:b"},
+		{Chart: "repo/a", Constraint: "2.x", Version: "2.0.1", Digest: "sha256:a2"},
+		{Chart: "repo/a", Constraint: "1.x", Version: "1.0.1", Digest: "sha256:a1"},
+	}}
+	assert.Nil(t, lock.Write(path), "should not return error")
+
+	read, err := ReadLock(path)
+	assert.Nil(t, err, "should not return error")
+	assert.Equal(t, []LockedChart{
+		{Chart: "repo/a", Constraint: "1.x", Version: "1.0.1", Digest: "sha256:a1"},
+		{Chart: "repo/a", Constraint: "2.x", Version: "2.0.1", Digest: "sha256:a2"},
+		{Chart: "repo/b", Constraint: "1.x", Version: "1.2.0", Digest: "sha256:b"},
+	}, read.Charts, "charts should be sorted by reference and constraint")
+	assert.Equal(t, "1.2.0", read.find("repo/b", "", "1.x").Version, "should find locked chart")
+	assert.Nil(t, read.find("repo/b", "", "2.x"), "should not find unlocked constraint")
+
+	_, err = ReadLock(filepath.Join(t.TempDir(), "missing.lock"))
+	assert.Error(t, err, "should return an error")
+}
+
+func TestLockLocalCharts(t *testing.T) {
+	h := Configuration{Chart: "tests/chart", ChartVersion: "0.x"}
+	locked, err := h.LockChart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), LockFileName)
+	assert.Nil(t, (&Lock{Charts: []LockedChart{locked}}).Write(path), "should not return error")
+
+	data, err := os.ReadFile(path)
+	assert.Nil(t, err, "should not return error")
+	assert.Contains(t, string(data), "chart: file://", "local charts should be stored relative to the lock file")
+
+	read, err := ReadLock(path)
+	assert.Nil(t, err, "should not return error")
+	chartPath, _ := filepath.Abs("tests/chart")
+	assert.Equal(t, chartPath, read.Charts[0].Chart, "local charts should be read as absolute paths")
+	assert.NotNil(t, read.find("tests/chart", "", "0.x"), "should find local chart by path")
+	assert.NotNil(t, read.find(chartPath, "", "0.x"), "should find local chart by absolute path")
+}
+
+func TestLoadChartLocked(t *testing.T) {
+	h := Configuration{Chart: "tests/chart", ChartVersion: "0.x"}
+	locked, err := h.LockChart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := locked
+	tampered.Digest = "sha256:0"
+
+	tests := []TestCase{
+		{
+			Name:     "matching digest",
+			Sample:   &Lock{Charts: []LockedChart{locked}},
+			Expected: false,
+		},
+		{
+			Name:     "mismatched digest",
+			Sample:   &Lock{Charts: []LockedChart{tampered}},
+			Expected: true,
+		},
+		{
+			Name:     "chart not locked",
+			Sample:   &Lock{},
+			Expected: true,
+		},
+	}
+	for i, test := range tests {
+		t.Logf("Test case %d: %s", i, test.Name)
+		for _, cache := range []*ChartCache{nil, NewChartCache("")} {
+			h := Configuration{Chart: "tests/chart", ChartVersion: "0.x", Lock: test.Sample.(*Lock), ChartCache: cache}
+			c, err := h.loadChart(&action.Install{})
+			if test.Expected.(bool) {
+				assert.Error(t, err, "should return an error")
+			} else {
+				assert.Nil(t, err, "should not return error")
+				assert.Equal(t, "chart", c.Name(), "should load the locked chart")
+			}
+		}
+	}
+}
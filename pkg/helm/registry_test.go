@@ -0,0 +1,221 @@
+package helm
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/registry"
+)
+
+var registryPath = regexp.MustCompile(`^/v2/(.+)/(manifests|blobs|tags)/(.+)$`)
+
+// testRegistry is a minimal stand-in for a registry:2 serving Helm charts
+type testRegistry struct {
+	username string
+	password string
+	// blobs and manifests by digest
+	blobs map[string][]byte
+	// manifest digests by repository and tag
+	tags map[string]map[string]string
+}
+
+// newTestRegistry serves the given charts as <repository>/<chart name>:<chart version>
+func newTestRegistry(t *testing.T, repository string, username string, password string, charts ...*chart.Chart) *httptest.Server {
+	r := &testRegistry{
+		username: username,
+		password: password,
+		blobs:    map[string][]byte{},
+		tags:     map[string]map[string]string{},
+	}
+	for _, c := range charts {
+		archive, err := chartutil.Save(c, t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := os.ReadFile(archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		config, err := json.Marshal(c.Metadata)
+		if err != nil {
+			t.Fatal(err)
+		}
+		manifest, err := json.Marshal(map[string]interface{}{
+			"schemaVersion": 2,
+			"config":        r.descriptor(registry.ConfigMediaType, config),
+			"layers":        []interface{}{r.descriptor(registry.ChartLayerMediaType, content)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := repository + "/" + c.Name()
+		if r.tags[name] == nil {
+			r.tags[name] = map[string]string{}
+		}
+		r.tags[name][c.Metadata.Version] = r.descriptor("", manifest)["digest"].(string)
+	}
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// descriptor stores content as a blob and returns its OCI descriptor
+func (r *testRegistry) descriptor(mediaType string, content []byte) map[string]interface{} {
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+	r.blobs[digest] = content
+	return map[string]interface{}{
+		"mediaType": mediaType,
+		"digest":    digest,
+		"size":      len(content),
+	}
+}
+
+func (r *testRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if r.username != "" {
+		if username, password, ok := req.BasicAuth(); !ok || username != r.username || password != r.password {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test-registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+	if req.URL.Path == "/v2/" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	match := registryPath.FindStringSubmatch(req.URL.Path)
+	if match == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	name, kind, reference := match[1], match[2], match[3]
+	tags, ok := r.tags[name]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if kind == "tags" {
+		var list []string
+		for tag := range tags {
+			list = append(list, tag)
+		}
+		sort.Strings(list)
+		w.Header().Set("Content-Type", "application/json")
+		//nolint:errcheck
+		json.NewEncoder(w).Encode(map[string]interface{}{"name": name, "tags": list})
+		return
+	}
+
+	digest := reference
+	if kind == "manifests" && !strings.HasPrefix(reference, "sha256:") {
+		digest = tags[reference]
+	}
+	content, ok := r.blobs[digest]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if kind == "manifests" {
+		w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+	w.WriteHeader(http.StatusOK)
+	if req.Method != http.MethodHead {
+		//nolint:errcheck
+		w.Write(content)
+	}
+}
+
+// writeRegistryConfig points Helm to a registry config with credentials for host, as
+// written by helm registry login
+func writeRegistryConfig(t *testing.T, host string, username string, password string) {
+	dir := t.TempDir()
+	auth := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+	config := fmt.Sprintf(`{"auths":{%q:{"auth":%q}}}`, host, auth)
+	if err := os.MkdirAll(filepath.Join(dir, "registry"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "registry", "config.json"), []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HELM_CONFIG_HOME", dir)
+	t.Setenv("HELM_REPOSITORY_CACHE", filepath.Join(dir, "repository"))
+}
+
+func TestLoadChartOCI(t *testing.T) {
+	oldChart := newCachedChart()
+	newChart := newCachedChart()
+	newChart.Metadata.Version = "1.1.0"
+	server := newTestRegistry(t, "charts", "user", "secret", oldChart, newChart)
+	host := strings.TrimPrefix(server.URL, "http://")
+	reference := fmt.Sprintf("oci://%s/charts/cached", host)
+
+	tests := []TestCase{
+		{
+			Name:     "exact version",
+			Sample:   []string{reference, "1.0.0", "secret"},
+			Expected: ReturnWithError{Value: "1.0.0"},
+		},
+		{
+			Name:     "version range",
+			Sample:   []string{reference, "~1", "secret"},
+			Expected: ReturnWithError{Value: "1.1.0"},
+		},
+		{
+			Name:     "non-existent version",
+			Sample:   []string{reference, "2.0.0", "secret"},
+			Expected: ReturnWithError{Error: true},
+		},
+		{
+			Name:     "invalid credentials",
+			Sample:   []string{reference, "1.0.0", "wrong"},
+			Expected: ReturnWithError{Error: true},
+		},
+	}
+	for i, test := range tests {
+		t.Logf("Test case %d: %s", i, test.Name)
+		sample := test.Sample.([]string)
+		expected := test.Expected.(ReturnWithError)
+		writeRegistryConfig(t, host, "user", sample[2])
+
+		h := Configuration{Chart: sample[0], ChartVersion: sample[1], Offline: true}
+		client, err := h.buildHelmClient("release", "namespace")
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := h.loadChart(client)
+		if expected.Error {
+			assert.Error(t, err, "should return an error")
+			continue
+		}
+		assert.Nil(t, err, "should not return error")
+		assert.Equal(t, expected.Value, c.Metadata.Version, "should pull the resolved version")
+
+		locked, err := h.LockChart()
+		assert.Nil(t, err, "should not return error")
+		assert.Equal(t, expected.Value, locked.Version, "should lock the resolved version")
+	}
+}
+
+func TestLoadChartOCIWithoutRegistryClient(t *testing.T) {
+	h := Configuration{Chart: "oci://localhost/charts/cached", ChartVersion: "1.0.0"}
+	_, err := h.loadChart(&action.Install{})
+	assert.Error(t, err, "should return an error")
+}
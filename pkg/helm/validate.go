@@ -0,0 +1,96 @@
+package helm
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/Masterminds/semver/v3"
+
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+// Validate checks the configuration used to render valuesFile without rendering its
+// chart. Every .helm.yaml from rootPath down to the folder of valuesFile is parsed in
+// strict mode, so unknown keys are reported, then the chart, chart version and release
+// identity are checked, as well as every file the configuration references. All the
+// problems found are returned.
+func (h *Configuration) Validate(rootPath string, valuesFile string) []error {
+	var errs []error
+	h.Strict = true
+	found := false
+	for _, dir := range ancestorDirs(rootPath, filepath.Dir(valuesFile)) {
+		applied, err := h.applyHelmYaml(dir)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		found = found || applied
+	}
+	if !found {
+		if err := h.BuildHelmConfig(nil); err != nil {
+			errs = append(errs, err)
+		}
+	} else if h.Chart == "" {
+		errs = append(errs, fmt.Errorf("Required configuration for helm chart missing"))
+	}
+	if h.ChartVersion != "" {
+		if _, err := semver.NewConstraint(h.ChartVersion); err != nil {
+			errs = append(errs, fmt.Errorf("Invalid chartVersion %q: %w", h.ChartVersion, err))
+		}
+	}
+	if h.KubeVersion != "" {
+		if _, err := chartutil.ParseKubeVersion(h.KubeVersion); err != nil {
+			errs = append(errs, fmt.Errorf("Invalid kubeVersion %q: %w", h.KubeVersion, err))
+		}
+	}
+	for _, env := range []string{h.UsernameEnv, h.PasswordEnv} {
+		if _, err := credentialFromEnv(env); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if h.PostRenderBinary != "" {
+		if _, err := exec.LookPath(h.PostRenderBinary); err != nil {
+			errs = append(errs, fmt.Errorf("Invalid postRenderBinary: %w", err))
+		}
+	}
+
+	files := []string{h.APIResourcesFile, h.APIVersionsFile, h.CaFile}
+	if h.Verify {
+		files = append(files, h.Keyring)
+	}
+	valuesReadable := true
+	for _, file := range append([]string{valuesFile}, h.ValuesFiles...) {
+		if err := checkReadable(file); err != nil {
+			errs = append(errs, err)
+			valuesReadable = false
+		}
+	}
+	for _, file := range files {
+		if file != "" {
+			if err := checkReadable(file); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	if valuesReadable {
+		vals, err := h.ReadValues(valuesFile)
+		if err == nil {
+			_, _, err = h.ReleaseIdentity(vals)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// checkReadable fails if file can't be opened for reading
+func checkReadable(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
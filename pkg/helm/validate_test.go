@@ -0,0 +1,104 @@
+package helm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []TestCase{
+		{
+			Name: "valid configuration",
+			Sample: map[string]string{
+				".helm.yaml":      "chart: ./chart\nchartVersion: ~1.0\nnamespace: ns\n",
+				"app/.helm.yaml":  "valuesFiles:\n  - ../common.yaml\n  - values.yaml\n",
+				"common.yaml":     "replicaCount: 1\n",
+				"app/values.yaml": "image: nginx\n",
+			},
+			Expected: []string{},
+		},
+		{
+			Name: "unknown keys on every .helm.yaml",
+			Sample: map[string]string{
+				".helm.yaml":      "chart: ./chart\nchartversion: 1.0.0\n",
+				"app/.helm.yaml":  "namepsace: ns\n",
+				"app/values.yaml": "namespace: ns\n",
+			},
+			Expected: []string{
+				"field chartversion not found",
+				"field namepsace not found",
+			},
+		},
+		{
+			Name: "default chart without version",
+			Sample: map[string]string{
+				"app/values.yaml": "namespace: ns\n",
+			},
+			Expected: []string{"Required configuration for default helm chart version missing"},
+		},
+		{
+			Name: "invalid values",
+			Sample: map[string]string{
+				".helm.yaml":      "chart: ./chart\nchartVersion: latest\nkubeVersion: one\npostRenderBinary: ./missing-binary\n",
+				"app/.helm.yaml":  "valuesFiles:\n  - values.yaml\n  - missing.yaml\napiVersionsFile: missing.txt\n",
+				"app/values.yaml": "releaseName: 1\n",
+			},
+			Expected: []string{
+				`Invalid chartVersion "latest"`,
+				`Invalid kubeVersion "one"`,
+				"Invalid postRenderBinary",
+				"missing.yaml: no such file or directory",
+				"missing.txt: no such file or directory",
+			},
+		},
+		{
+			Name: "invalid release identity",
+			Sample: map[string]string{
+				".helm.yaml":      "chart: ./chart\nchartVersion: 1.0.0\n",
+				"app/values.yaml": "releaseName: 1\n",
+			},
+			Expected: []string{"Missing required field [namespace]"},
+		},
+	}
+	for i, test := range tests {
+		t.Logf("Test case %d: %s", i, test.Name)
+		root := t.TempDir()
+		for name, content := range test.Sample.(map[string]string) {
+			file := filepath.Join(root, name)
+			if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		h := Configuration{Chart: "default-chart", HelmYaml: ".helm.yaml", ValuesYaml: "values.yaml"}
+		errs := h.Validate(root, filepath.Join(root, "app", "values.yaml"))
+		expected := test.Expected.([]string)
+		assert.Len(t, errs, len(expected), "should report every problem: %v", errs)
+		for j := range expected {
+			if j < len(errs) {
+				assert.Contains(t, errs[j].Error(), expected[j], "should report the expected problem")
+			}
+		}
+	}
+}
+
+func TestBuildHelmConfigFromPathStrict(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, ".helm.yaml"), []byte("chart: ./chart\nchartversion: 1.0.0\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	h := Configuration{HelmYaml: ".helm.yaml"}
+	assert.Nil(t, h.BuildHelmConfigFromPath(root, root), "unknown keys should be ignored by default")
+
+	h = Configuration{HelmYaml: ".helm.yaml", Strict: true}
+	err := h.BuildHelmConfigFromPath(root, root)
+	assert.Error(t, err, "unknown keys should fail in strict mode")
+	assert.Contains(t, err.Error(), "field chartversion not found", "should report the unknown key")
+}
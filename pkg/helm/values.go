@@ -0,0 +1,182 @@
+package helm
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/topfreegames/helm-generate/pkg/util"
+
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/strvals"
+)
+
+// KeyValueAssignments holds the assignments given through --set, --set-string,
+// --set-file and --set-json, using Helm's strvals syntax
+type KeyValueAssignments struct {
+	JSONValues   []string
+	Values       []string
+	StringValues []string
+	FileValues   []string
+}
+
+// MergeInto applies the assignments on top of vals, in the same order as Helm does:
+// JSON values first, then values, string values and file values.
+func (a *KeyValueAssignments) MergeInto(vals map[string]interface{}) error {
+	for _, value := range a.JSONValues {
+		if err := parseIntoJSON(value, vals); err != nil {
+			return fmt.Errorf("failed parsing --set-json data %s: %w", value, err)
+		}
+	}
+	for _, value := range a.Values {
+		if err := strvals.ParseInto(value, vals); err != nil {
+			return fmt.Errorf("failed parsing --set data %s: %w", value, err)
+		}
+	}
+	for _, value := range a.StringValues {
+		if err := strvals.ParseIntoString(value, vals); err != nil {
+			return fmt.Errorf("failed parsing --set-string data %s: %w", value, err)
+		}
+	}
+	for _, value := range a.FileValues {
+		reader := func(rs []rune) (interface{}, error) {
+			bytes, err := os.ReadFile(string(rs))
+			return string(bytes), err
+		}
+		if err := strvals.ParseIntoFile(value, vals, reader); err != nil {
+			return fmt.Errorf("failed parsing --set-file data %s: %w", value, err)
+		}
+	}
+	return nil
+}
+
+// Validate checks the syntax of every assignment without reading any file
+func (a *KeyValueAssignments) Validate() error {
+	noFiles := *a
+	noFiles.FileValues = nil
+	if err := noFiles.MergeInto(map[string]interface{}{}); err != nil {
+		return err
+	}
+	for _, value := range a.FileValues {
+		reader := func(rs []rune) (interface{}, error) {
+			return string(rs), nil
+		}
+		if err := strvals.ParseIntoFile(value, map[string]interface{}{}, reader); err != nil {
+			return fmt.Errorf("failed parsing --set-file data %s: %w", value, err)
+		}
+	}
+	return nil
+}
+
+// parseIntoJSON parses a <key>=<json> assignment, where key follows the strvals
+// syntax, and merges the result into dest
+func parseIntoJSON(s string, dest map[string]interface{}) error {
+	key, value, found := strings.Cut(s, "=")
+	if !found || key == "" {
+		return fmt.Errorf("assignment is not of the form <key>=<json>")
+	}
+	var jsonValue interface{}
+	if err := json.Unmarshal([]byte(value), &jsonValue); err != nil {
+		return err
+	}
+	// The strvals parser handles the key path, the value placeholder is replaced by the JSON value
+	reader := func([]rune) (interface{}, error) {
+		return jsonValue, nil
+	}
+	return strvals.ParseIntoFile(key+"=json", dest, reader)
+}
+
+// Sources of the release name and namespace, besides the .helm.yaml setting them
+const (
+	SourceValuesFile = "values file"
+	SourceSetFlag    = "--set"
+	SourceFolderName = "folder name"
+)
+
+// ReadValues reads valuesFile and merges the ValuesFiles on top of it, in order,
+// using Helm's deep-merge semantics. If valuesFile itself is listed on ValuesFiles
+// it is merged at that position, otherwise it is the first one.
+// The ReleaseName and Namespace set on the .helm.yaml and then the KeyValueAssignments
+// are applied on top of the merged values. If the release name is still missing, it is
+// the name of the folder of valuesFile.
+func (h *Configuration) ReadValues(valuesFile string) (chartutil.Values, error) {
+	files := []string{}
+	listed := false
+	for _, file := range h.ValuesFiles {
+		if filepath.Clean(file) == filepath.Clean(valuesFile) {
+			listed = true
+		}
+		files = append(files, file)
+	}
+	if !listed {
+		files = append([]string{valuesFile}, files...)
+	}
+
+	vals := map[string]interface{}{}
+	for _, file := range files {
+		fileVals, err := chartutil.ReadValuesFile(file)
+		if err != nil {
+			return nil, err
+		}
+		vals = util.MergeMaps(vals, fileVals)
+	}
+	identityKeys := map[string]string{
+		"releaseName": h.releaseNameKey(),
+		"namespace":   h.namespaceKey(),
+	}
+	overrides := map[string]string{
+		"releaseName": h.ReleaseName,
+		"namespace":   h.Namespace,
+	}
+	for name, key := range identityKeys {
+		if overrides[name] != "" {
+			if err := setValue(vals, key, overrides[name]); err != nil {
+				return nil, err
+			}
+		} else if _, ok := lookupValue(vals, key); ok {
+			h.SetSource(name, SourceValuesFile)
+		}
+	}
+	if h.KeyValueAssignments != nil {
+		before := map[string]interface{}{}
+		for name, key := range identityKeys {
+			before[name], _ = lookupValue(vals, key)
+		}
+		if err := h.KeyValueAssignments.MergeInto(vals); err != nil {
+			return nil, err
+		}
+		for name, key := range identityKeys {
+			if value, ok := lookupValue(vals, key); ok && !reflect.DeepEqual(value, before[name]) {
+				h.SetSource(name, SourceSetFlag)
+			}
+		}
+	}
+	if _, ok := lookupValue(vals, h.releaseNameKey()); !ok {
+		dir, err := filepath.Abs(filepath.Dir(valuesFile))
+		if err != nil {
+			return nil, err
+		}
+		if err := setValue(vals, h.releaseNameKey(), filepath.Base(dir)); err != nil {
+			return nil, err
+		}
+		h.SetSource("releaseName", SourceFolderName)
+	}
+	return vals, nil
+}
+
+// lookupValue returns the value on the dotted key path of vals, if set
+func lookupValue(vals map[string]interface{}, key string) (interface{}, bool) {
+	value, err := util.NestedMapLookup(vals, strings.Split(key, ".")...)
+	return value, err == nil
+}
+
+// setValue sets value on the dotted key path of vals, as in global.namespace
+func setValue(vals map[string]interface{}, key string, value interface{}) error {
+	if err := util.SetNestedValue(vals, value, strings.Split(key, ".")...); err != nil {
+		return fmt.Errorf("Error setting value %s: %w", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package helm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyValueAssignmentsMergeInto(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	if err := os.WriteFile(certFile, []byte("-----BEGIN CERTIFICATE-----"), 0o600); err != nil {
+		t.Fatalf("couldn't write test file: %v", err)
+	}
+	tests := []TestCase{
+		{
+			Name: "nested paths and type inference",
+			Sample: KeyValueAssignments{
+				Values: []string{"image.tag=abc", "replicaCount=3", "enabled=true"},
+			},
+			Expected: ReturnWithError{
+				Value: map[string]interface{}{
+					"image":        map[string]interface{}{"repository": "nginx", "tag": "abc"},
+					"replicaCount": int64(3),
+					"enabled":      true,
+				},
+				Error: false,
+			},
+		},
+		{
+			Name: "values containing equal signs",
+			Sample: KeyValueAssignments{
+				Values: []string{"database.url=postgres://host/db?sslmode=disable"},
+			},
+			Expected: ReturnWithError{
+				Value: map[string]interface{}{
+					"image":    map[string]interface{}{"repository": "nginx"},
+					"database": map[string]interface{}{"url": "postgres://host/db?sslmode=disable"},
+				},
+				Error: false,
+			},
+		},
+		{
+			Name: "list indexes",
+			Sample: KeyValueAssignments{
+				Values: []string{"hosts[0]=a.example.com", "hosts[1]=b.example.com"},
+			},
+			Expected: ReturnWithError{
+				Value: map[string]interface{}{
+					"image": map[string]interface{}{"repository": "nginx"},
+					"hosts": []interface{}{"a.example.com", "b.example.com"},
+				},
+				Error: false,
+			},
+		},
+		{
+			Name: "string values, file values and json values",
+			Sample: KeyValueAssignments{
+				JSONValues:   []string{`image={"tag": "1.0", "pullPolicy": "Always"}`},
+				StringValues: []string{"image.tag=2"},
+				FileValues:   []string{"tls.cert=" + certFile},
+			},
+			Expected: ReturnWithError{
+				Value: map[string]interface{}{
+					"image": map[string]interface{}{"tag": "2", "pullPolicy": "Always"},
+					"tls":   map[string]interface{}{"cert": "-----BEGIN CERTIFICATE-----"},
+				},
+				Error: false,
+			},
+		},
+		{
+			Name: "invalid json",
+			Sample: KeyValueAssignments{
+				JSONValues: []string{`image={"tag"`},
+			},
+			Expected: ReturnWithError{
+				Value: nil,
+				Error: true,
+			},
+		},
+		{
+			Name: "missing value",
+			Sample: KeyValueAssignments{
+				Values: []string{"image.tag"},
+			},
+			Expected: ReturnWithError{
+				Value: nil,
+				Error: true,
+			},
+		},
+	}
+	for i, test := range tests {
+		t.Logf("Test case %d: %s", i, test.Name)
+		expected := test.Expected.(ReturnWithError)
+		assignments := test.Sample.(KeyValueAssignments)
+
+		vals := map[string]interface{}{
+			"image": map[string]interface{}{"repository": "nginx"},
+		}
+		validationErr := assignments.Validate()
+		err := assignments.MergeInto(vals)
+		if expected.Error {
+			assert.Error(t, validationErr, "should fail validation")
+			assert.Error(t, err, "should return an error")
+		} else {
+			assert.Nil(t, validationErr, "should pass validation")
+			assert.Nil(t, err, "should not return error")
+			assert.Equal(t, expected.Value, vals, "values should match the expected value")
+		}
+	}
+}
+
+func TestReadValuesReleaseIdentity(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "my-app")
+	valuesFile := filepath.Join(dir, "values.yaml")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(valuesFile, []byte("releaseName: from-values\nglobal:\n  namespace: from-values\n"), 0o600); err != nil {
+		t.Fatalf("couldn't write test file: %v", err)
+	}
+
+	tests := []TestCase{
+		{
+			Name:     "values keys",
+			Sample:   Configuration{NamespaceKey: "global.namespace"},
+			Expected: []string{"from-values", "from-values"},
+		},
+		{
+			Name:     "helm yaml overrides values",
+			Sample:   Configuration{ReleaseName: "from-helm-yaml", Namespace: "from-helm-yaml", NamespaceKey: "global.namespace"},
+			Expected: []string{"from-helm-yaml", "from-helm-yaml"},
+		},
+		{
+			Name: "set overrides helm yaml",
+			Sample: Configuration{
+				Namespace:           "from-helm-yaml",
+				NamespaceKey:        "global.namespace",
+				KeyValueAssignments: &KeyValueAssignments{Values: []string{"global.namespace=from-set"}},
+			},
+			Expected: []string{"from-values", "from-set"},
+		},
+		{
+			Name:     "release name from the folder",
+			Sample:   Configuration{ReleaseNameKey: "release.name", NamespaceKey: "global.namespace"},
+			Expected: []string{"my-app", "from-values"},
+		},
+	}
+	for i, test := range tests {
+		t.Logf("Test case %d: %s", i, test.Name)
+		h := test.Sample.(Configuration)
+		expected := test.Expected.([]string)
+
+		vals, err := h.ReadValues(valuesFile)
+		assert.Nil(t, err, "should not return error")
+		name, namespace, err := h.ReleaseIdentity(vals)
+		assert.Nil(t, err, "should not return error")
+		assert.Equal(t, expected, []string{name, namespace}, "release identity should match")
+	}
+}
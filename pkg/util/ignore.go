@@ -0,0 +1,122 @@
+package util
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// IgnoreRules are the patterns of an ignore file, using the gitignore syntax
+type IgnoreRules []ignoreRule
+
+type ignoreRule struct {
+	pattern *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// ParseIgnoreRules reads an ignore file. As on a .gitignore, blank lines and lines
+// starting with # are skipped, a leading ! re-includes what previous patterns
+// excluded, a trailing / only matches folders and patterns without a / in the middle
+// match at any depth. Paths are matched relative to the folder of the ignore file.
+func ParseIgnoreRules(r io.Reader) (IgnoreRules, error) {
+	var rules IgnoreRules
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimRight(line, " ")
+		// Trailing spaces are kept when escaped with a backslash
+		if strings.HasSuffix(trimmed, `\`) && len(trimmed) < len(line) {
+			trimmed += " "
+		}
+		line = trimmed
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		rule := ignoreRule{}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			line = strings.TrimPrefix(line, "/")
+		} else {
+			line = "**/" + line
+		}
+		pattern, err := CompileGlob(line)
+		if err != nil {
+			return nil, err
+		}
+		rule.pattern = pattern
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+// Match reports whether path, relative to the folder of the ignore file and separated
+// by slashes, is ignored. As the last matching pattern wins, matched tells whether any
+// pattern matched, so rules from a nested ignore file can override the parent ones.
+func (rules IgnoreRules) Match(path string, isDir bool) (ignored bool, matched bool) {
+	for _, rule := range rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if rule.pattern.MatchString(path) {
+			ignored = !rule.negate
+			matched = true
+		}
+	}
+	return ignored, matched
+}
+
+// CompileGlob compiles a glob matching whole slash separated paths. * and ? don't
+// match slashes, character classes can be negated with ! and ** matches any number
+// of folders when it is a whole path segment.
+func CompileGlob(glob string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		segmentStart := i == 0 || glob[i-1] == '/'
+		switch c := glob[i]; {
+		case segmentStart && strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case segmentStart && glob[i:] == "**":
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("Invalid glob %q: unterminated character class", glob)
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	b.WriteString("$")
+	pattern, err := regexp.Compile(b.String())
+	if err != nil {
+		return nil, fmt.Errorf("Invalid glob %q: %w", glob, err)
+	}
+	return pattern, nil
+}
@@ -0,0 +1,105 @@
+package util
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompileGlob(t *testing.T) {
+	tests := []TestCase{
+		{
+			Name:     "star doesn't match slashes",
+			Sample:   []string{"apps/*", "apps/api", "apps/api/worker"},
+			Expected: []bool{true, false},
+		},
+		{
+			Name:     "double star matches any number of folders",
+			Sample:   []string{"**/legacy/**", "legacy/api", "apps/legacy/api/worker"},
+			Expected: []bool{true, true},
+		},
+		{
+			Name:     "question mark and character classes",
+			Sample:   []string{"ns[!2]/app?", "ns1/app1", "ns2/app2"},
+			Expected: []bool{true, false},
+		},
+		{
+			Name:     "escaped characters",
+			Sample:   []string{`app\*`, "app*", "app1"},
+			Expected: []bool{true, false},
+		},
+	}
+	for i, test := range tests {
+		t.Logf("Test case %d: %s", i, test.Name)
+		sample := test.Sample.([]string)
+		pattern, err := CompileGlob(sample[0])
+		assert.Nil(t, err, "should not return error")
+		var matches []bool
+		for _, path := range sample[1:] {
+			matches = append(matches, pattern.MatchString(path))
+		}
+		assert.Equal(t, test.Expected, matches, "matches should match the expected value")
+	}
+
+	_, err := CompileGlob("app[1")
+	assert.Error(t, err, "should fail on unterminated character classes")
+}
+
+func TestIgnoreRulesMatch(t *testing.T) {
+	rules, err := ParseIgnoreRules(strings.NewReader(`
+# comment
+node_modules
+/archived/
+apps/*/drafts
+*.bak
+!keep.bak
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []TestCase{
+		{
+			Name:     "name matches at any depth",
+			Sample:   []interface{}{"apps/api/node_modules", true},
+			Expected: []bool{true, true},
+		},
+		{
+			Name:     "leading slash anchors to the ignore file folder",
+			Sample:   []interface{}{"apps/archived", true},
+			Expected: []bool{false, false},
+		},
+		{
+			Name:     "trailing slash only matches folders",
+			Sample:   []interface{}{"archived", false},
+			Expected: []bool{false, false},
+		},
+		{
+			Name:     "anchored folder",
+			Sample:   []interface{}{"archived", true},
+			Expected: []bool{true, true},
+		},
+		{
+			Name:     "pattern with a slash in the middle",
+			Sample:   []interface{}{"apps/api/drafts", true},
+			Expected: []bool{true, true},
+		},
+		{
+			Name:     "negated pattern",
+			Sample:   []interface{}{"apps/keep.bak", false},
+			Expected: []bool{false, true},
+		},
+		{
+			Name:     "no pattern matches",
+			Sample:   []interface{}{"apps/api", true},
+			Expected: []bool{false, false},
+		},
+	}
+	for i, test := range tests {
+		t.Logf("Test case %d: %s", i, test.Name)
+		sample := test.Sample.([]interface{})
+		ignored, matched := rules.Match(sample[0].(string), sample[1].(bool))
+		assert.Equal(t, test.Expected, []bool{ignored, matched}, "ignored and matched should match the expected value")
+	}
+}
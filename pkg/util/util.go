@@ -1,8 +1,11 @@
 package util
 
 import (
+	"bufio"
 	"fmt"
 	"io"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/mitchellh/hashstructure"
@@ -23,17 +26,27 @@ type Namespace struct {
 	Metadata   Metadata `yaml:"metadata"`
 }
 
-// CreateNamespace generates a map with namespace definitions
+// CreateNamespace generates a map with namespace definitions, annotated so that
+// Flux v1 doesn't delete it when the namespace isn't synced anymore
 func CreateNamespace(ns string, annotations map[string]string, labels map[string]string) map[string]interface{} {
 	if annotations == nil {
 		annotations = make(map[string]string)
 	}
-	if labels == nil {
-		labels = make(map[string]string)
-	}
 	if annotations["fluxcd.io/ignore"] == "" {
 		annotations["fluxcd.io/ignore"] = "sync_only"
 	}
+	return NewNamespace(ns, annotations, labels)
+}
+
+// NewNamespace generates a map with namespace definitions using exactly the given
+// annotations and labels, besides the name label
+func NewNamespace(ns string, annotations map[string]string, labels map[string]string) map[string]interface{} {
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	if labels == nil {
+		labels = make(map[string]string)
+	}
 	labels["name"] = ns
 	namespace, _ := yaml.Marshal(&Namespace{
 		APIVersion: "v1",
@@ -63,6 +76,260 @@ func WalkDedup(list []map[string]interface{}, f func(element map[string]interfac
 	}
 }
 
+// MergeMaps deep-merges b on top of a, returning a new map, the same way Helm
+// merges multiple values files: nested maps are merged and any other value in b
+// replaces the one in a.
+func MergeMaps(a, b map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(a))
+	for k, v := range a {
+		out[k] = v
+	}
+	for k, v := range b {
+		if v, ok := v.(map[string]interface{}); ok {
+			if bv, ok := out[k]; ok {
+				if bv, ok := bv.(map[string]interface{}); ok {
+					out[k] = MergeMaps(bv, v)
+					continue
+				}
+			}
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// Resource is a rendered manifest along with the folder and release it was rendered from
+type Resource struct {
+	Manifest  map[string]interface{}
+	Source    string
+	Release   string
+	Namespace string
+}
+
+// KindAndName returns the kind and metadata.name of the resource manifest
+func (r Resource) KindAndName() (string, string) {
+	kind, _ := r.Manifest["kind"].(string)
+	metadata, _ := toStringMap(r.Manifest["metadata"])
+	name, _ := metadata["name"].(string)
+	return kind, name
+}
+
+// Conflict describes resources sharing the same identity but with different contents
+type Conflict struct {
+	Identity string
+	Sources  []string
+	Reason   string
+}
+
+// ConflictError reports every conflict found by DedupResources
+type ConflictError struct {
+	Conflicts []Conflict
+}
+
+func (e *ConflictError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d conflicting resource(s) found:", len(e.Conflicts))
+	for _, conflict := range e.Conflicts {
+		fmt.Fprintf(&b, "\n  - %s rendered from %s: %s", conflict.Identity, strings.Join(conflict.Sources, ", "), conflict.Reason)
+	}
+	return b.String()
+}
+
+// DedupResources deduplicates resources by their apiVersion, kind, namespace and name.
+// Resources with the same identity must have the same contents, except for Namespaces,
+// whose labels and annotations are merged as long as they don't disagree on a value.
+// Resources without a kind or name are only deduplicated if they are identical.
+// The first occurrence of each resource keeps its position on the list.
+func DedupResources(resources []Resource) ([]Resource, error) {
+	var deduped []Resource
+	hashList := make(map[uint64]bool)
+	byIdentity := make(map[string]int)
+	sources := make(map[string][]string)
+	conflicting := make(map[string]string)
+	var identities []string
+
+	for _, resource := range resources {
+		identity, ok := resourceIdentity(resource.Manifest)
+		if !ok {
+			// This always return nil as err parameter
+			itemHash, _ := hashstructure.Hash(resource.Manifest, nil)
+			if !hashList[itemHash] {
+				hashList[itemHash] = true
+				deduped = append(deduped, resource)
+			}
+			continue
+		}
+
+		if !containsString(sources[identity], resource.Source) {
+			sources[identity] = append(sources[identity], resource.Source)
+		}
+		i, found := byIdentity[identity]
+		if !found {
+			byIdentity[identity] = len(deduped)
+			identities = append(identities, identity)
+			deduped = append(deduped, resource)
+			continue
+		}
+		merged, err := mergeResources(deduped[i].Manifest, resource.Manifest)
+		if err != nil {
+			if _, ok := conflicting[identity]; !ok {
+				conflicting[identity] = err.Error()
+			}
+			continue
+		}
+		deduped[i].Manifest = merged
+	}
+
+	if len(conflicting) > 0 {
+		conflictErr := &ConflictError{}
+		for _, identity := range identities {
+			if reason, ok := conflicting[identity]; ok {
+				conflictErr.Conflicts = append(conflictErr.Conflicts, Conflict{
+					Identity: identity,
+					Sources:  sources[identity],
+					Reason:   reason,
+				})
+			}
+		}
+		return nil, conflictErr
+	}
+	return deduped, nil
+}
+
+// SortResources sorts the resources by kind, following kindOrder, and then by
+// namespace and name. Kinds missing from kindOrder come last, sorted alphabetically.
+// The sort is stable, so resources with the same kind, namespace and name keep their order.
+func SortResources(resources []Resource, kindOrder []string) {
+	rank := make(map[string]int, len(kindOrder))
+	for i, kind := range kindOrder {
+		rank[kind] = i
+	}
+	kindRank := func(kind string) int {
+		if r, ok := rank[kind]; ok {
+			return r
+		}
+		return len(kindOrder)
+	}
+	sort.SliceStable(resources, func(i, j int) bool {
+		kindI, nameI := resources[i].KindAndName()
+		kindJ, nameJ := resources[j].KindAndName()
+		if rankI, rankJ := kindRank(kindI), kindRank(kindJ); rankI != rankJ {
+			return rankI < rankJ
+		}
+		if kindI != kindJ {
+			return kindI < kindJ
+		}
+		metadataI, _ := toStringMap(resources[i].Manifest["metadata"])
+		metadataJ, _ := toStringMap(resources[j].Manifest["metadata"])
+		namespaceI, _ := metadataI["namespace"].(string)
+		namespaceJ, _ := metadataJ["namespace"].(string)
+		if namespaceI != namespaceJ {
+			return namespaceI < namespaceJ
+		}
+		return nameI < nameJ
+	})
+}
+
+// mergeResources merges two manifests with the same identity
+func mergeResources(a, b map[string]interface{}) (map[string]interface{}, error) {
+	hashA, _ := hashstructure.Hash(a, nil)
+	hashB, _ := hashstructure.Hash(b, nil)
+	if hashA == hashB {
+		return a, nil
+	}
+	if a["kind"] != "Namespace" {
+		return nil, fmt.Errorf("contents differ")
+	}
+
+	// Apart from labels and annotations, both Namespaces must be the same
+	stripped := func(m map[string]interface{}) map[string]interface{} {
+		c := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			c[k] = v
+		}
+		md, _ := toStringMap(m["metadata"])
+		mdCopy := make(map[string]interface{}, len(md))
+		for k, v := range md {
+			if k != "labels" && k != "annotations" {
+				mdCopy[k] = v
+			}
+		}
+		c["metadata"] = mdCopy
+		return c
+	}
+	hashA, _ = hashstructure.Hash(stripped(a), nil)
+	hashB, _ = hashstructure.Hash(stripped(b), nil)
+	if hashA != hashB {
+		return nil, fmt.Errorf("contents differ")
+	}
+
+	merged := make(map[string]interface{}, len(a))
+	for k, v := range a {
+		merged[k] = v
+	}
+	metadataA, _ := toStringMap(a["metadata"])
+	metadataB, _ := toStringMap(b["metadata"])
+	metadata := make(map[string]interface{}, len(metadataA))
+	for k, v := range metadataA {
+		metadata[k] = v
+	}
+	for _, field := range []string{"labels", "annotations"} {
+		fieldA, _ := toStringMap(metadataA[field])
+		fieldB, _ := toStringMap(metadataB[field])
+		values := make(map[interface{}]interface{}, len(fieldA)+len(fieldB))
+		for k, v := range fieldA {
+			values[k] = v
+		}
+		for k, v := range fieldB {
+			if existing, ok := values[k]; ok && existing != v {
+				return nil, fmt.Errorf("%s %q differs: %v != %v", field, k, existing, v)
+			}
+			values[k] = v
+		}
+		if len(values) > 0 {
+			metadata[field] = values
+		}
+	}
+	merged["metadata"] = metadata
+	return merged, nil
+}
+
+// resourceIdentity returns the apiVersion/kind/namespace/name of a manifest, if it has a kind and a name
+func resourceIdentity(manifest map[string]interface{}) (string, bool) {
+	kind, name := Resource{Manifest: manifest}.KindAndName()
+	apiVersion, _ := manifest["apiVersion"].(string)
+	metadata, _ := toStringMap(manifest["metadata"])
+	namespace, _ := metadata["namespace"].(string)
+	if kind == "" || name == "" {
+		return "", false
+	}
+	return fmt.Sprintf("%s/%s %s/%s", apiVersion, kind, namespace, name), true
+}
+
+// toStringMap converts the maps produced by the YAML decoder to map[string]interface{}
+func toStringMap(value interface{}) (map[string]interface{}, bool) {
+	switch m := value.(type) {
+	case map[string]interface{}:
+		return m, true
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			converted[fmt.Sprintf("%v", k)] = v
+		}
+		return converted, true
+	}
+	return nil, false
+}
+
+func containsString(list []string, s string) bool {
+	for _, elem := range list {
+		if elem == s {
+			return true
+		}
+	}
+	return false
+}
+
 // NestedMapLookup as found on https://gist.github.com/ChristopherThorpe/fd3720efe2ba83c929bf4105719ee967
 // m:  a map from strings to other maps or values, of arbitrary depth
 // ks: successive keys to reach an internal or leaf node (variadic)
@@ -88,12 +355,44 @@ func NestedMapLookup(m map[string]interface{}, ks ...string) (rval interface{},
 	}
 }
 
-// ValidateValues validates if some required keys exists on a map
+// SetNestedValue sets value on the node reached by the successive keys ks, creating
+// the missing internal maps. It fails if an internal node exists but isn't a map.
+func SetNestedValue(m map[string]interface{}, value interface{}, ks ...string) error {
+	if len(ks) == 0 {
+		return fmt.Errorf("SetNestedValue needs at least one key")
+	}
+	if len(ks) == 1 {
+		m[ks[0]] = value
+		return nil
+	}
+	next, ok := m[ks[0]]
+	if !ok || next == nil {
+		next = map[string]interface{}{}
+		m[ks[0]] = next
+	}
+	nextMap, ok := next.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("malformed structure at %#v", next)
+	}
+	return SetNestedValue(nextMap, value, ks[1:]...)
+}
+
+// MissingFieldsError is returned by ValidateValues when some required fields are missing
+type MissingFieldsError struct {
+	Fields []string
+}
+
+func (e *MissingFieldsError) Error() string {
+	return fmt.Sprintf("Missing required field %v", e.Fields)
+}
+
+// ValidateValues validates if some required keys exists on a map. Nested keys are
+// separated by dots, as in global.namespace.
 func ValidateValues(values map[string]interface{}, requiredFields ...string) (map[string]interface{}, error) {
 	requiredValues := make(map[string]interface{})
 	failedFields := []string{}
 	for _, field := range requiredFields {
-		value, err := NestedMapLookup(values, field)
+		value, err := NestedMapLookup(values, strings.Split(field, ".")...)
 		if err != nil {
 			failedFields = append(failedFields, field)
 		} else {
@@ -101,11 +400,79 @@ func ValidateValues(values map[string]interface{}, requiredFields ...string) (ma
 		}
 	}
 
-	var err error = nil
 	if len(failedFields) > 0 {
-		err = fmt.Errorf("Missing required field %v", failedFields)
+		return requiredValues, &MissingFieldsError{Fields: failedFields}
+	}
+	return requiredValues, nil
+}
+
+// ParseAPIResources parses the output of `kubectl api-resources` and returns,
+// for each kind, whether it is namespaced
+func ParseAPIResources(r io.Reader) (map[string]bool, error) {
+	scanner := bufio.NewScanner(r)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("Missing header line")
+	}
+	header := scanner.Text()
+	namespacedColumn := strings.Index(header, "NAMESPACED")
+	kindColumn := strings.Index(header, "KIND")
+	if namespacedColumn < 0 || kindColumn < 0 {
+		return nil, fmt.Errorf("Header must have NAMESPACED and KIND columns: %q", header)
+	}
+	column := func(line string, start int) string {
+		if start >= len(line) {
+			return ""
+		}
+		fields := strings.Fields(line[start:])
+		if len(fields) == 0 {
+			return ""
+		}
+		return fields[0]
+	}
+
+	resources := make(map[string]bool)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		kind := column(line, kindColumn)
+		namespaced, err := strconv.ParseBool(column(line, namespacedColumn))
+		if kind == "" || err != nil {
+			return nil, fmt.Errorf("Malformed API resource line: %q", line)
+		}
+		resources[kind] = namespaced
+	}
+	return resources, scanner.Err()
+}
+
+// ToJSONCompatible converts the maps with interface{} keys produced by the YAML
+// decoder, at any depth, to maps with string keys, so they can be encoded to JSON
+func ToJSONCompatible(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for k, elem := range v {
+			converted[fmt.Sprintf("%v", k)] = ToJSONCompatible(elem)
+		}
+		return converted
+	case map[string]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for k, elem := range v {
+			converted[k] = ToJSONCompatible(elem)
+		}
+		return converted
+	case []interface{}:
+		converted := make([]interface{}, len(v))
+		for i, elem := range v {
+			converted[i] = ToJSONCompatible(elem)
+		}
+		return converted
 	}
-	return requiredValues, err
+	return value
 }
 
 // DecodeYamls parse a list of yamls defined on a string to a list of maps
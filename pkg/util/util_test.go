@@ -1,6 +1,7 @@
 package util
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -94,6 +95,20 @@ func TestCreateNamespace(t *testing.T) {
 	}
 }
 
+func TestNewNamespace(t *testing.T) {
+	expected := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Namespace",
+		"metadata": map[interface{}]interface{}{
+			"annotations": map[interface{}]interface{}{"owner": "team-a"},
+			"labels":      map[interface{}]interface{}{"name": "ns", "istio-injection": "enabled"},
+			"name":        "ns",
+		},
+	}
+	result := NewNamespace("ns", map[string]string{"owner": "team-a"}, map[string]string{"istio-injection": "enabled"})
+	assert.Equal(t, expected, result, "should not add the default flux annotation")
+}
+
 func TestWalkDedup(t *testing.T) {
 	a := map[string]interface{}{
 		"hello":  "world",
@@ -296,6 +311,16 @@ func TestValidateValues(t *testing.T) {
 			},
 			Sample: []string{"first", "fifth", "fourth", "second"},
 		},
+		{
+			Name: "nested required field",
+			Expected: ReturnWithError{
+				Value: map[string]interface{}{
+					"first.internal.string": "string",
+				},
+				Error: false,
+			},
+			Sample: []string{"first.internal.string"},
+		},
 		{
 			Name: "no required field",
 			Expected: ReturnWithError{
@@ -323,6 +348,51 @@ func TestValidateValues(t *testing.T) {
 	}
 }
 
+func TestSetNestedValue(t *testing.T) {
+	tests := []TestCase{
+		{
+			Name:     "top level key",
+			Sample:   []string{"namespace"},
+			Expected: ReturnWithError{Value: map[string]interface{}{"namespace": "value", "global": map[string]interface{}{"cluster": "a"}, "replicaCount": 1}},
+		},
+		{
+			Name:     "existing nested map",
+			Sample:   []string{"global", "namespace"},
+			Expected: ReturnWithError{Value: map[string]interface{}{"global": map[string]interface{}{"cluster": "a", "namespace": "value"}, "replicaCount": 1}},
+		},
+		{
+			Name:     "missing nested map",
+			Sample:   []string{"release", "name"},
+			Expected: ReturnWithError{Value: map[string]interface{}{"release": map[string]interface{}{"name": "value"}, "global": map[string]interface{}{"cluster": "a"}, "replicaCount": 1}},
+		},
+		{
+			Name:     "internal node is not a map",
+			Sample:   []string{"replicaCount", "name"},
+			Expected: ReturnWithError{Error: true},
+		},
+		{
+			Name:     "no keys",
+			Sample:   []string{},
+			Expected: ReturnWithError{Error: true},
+		},
+	}
+
+	for i, test := range tests {
+		t.Logf("Test case %d: %s", i, test.Name)
+
+		expected := test.Expected.(ReturnWithError)
+		m := map[string]interface{}{"global": map[string]interface{}{"cluster": "a"}, "replicaCount": 1}
+		err := SetNestedValue(m, "value", test.Sample.([]string)...)
+
+		if expected.Error {
+			assert.Error(t, err, "should return an error")
+		} else {
+			assert.Nil(t, err, "should not return error")
+			assert.Equal(t, expected.Value, m, "value should be set on the map")
+		}
+	}
+}
+
 func TestDecodeYamls(t *testing.T) {
 	tests := []TestCase{
 		{
@@ -384,3 +454,297 @@ deep:
 		}
 	}
 }
+
+func TestMergeMaps(t *testing.T) {
+	base := map[string]interface{}{
+		"name": "base",
+		"image": map[string]interface{}{
+			"repository": "nginx",
+			"tag":        "1.0",
+		},
+		"list": []interface{}{"a", "b"},
+	}
+	tests := []TestCase{
+		{
+			Name: "deep merge nested maps",
+			Sample: map[string]interface{}{
+				"image": map[string]interface{}{"tag": "2.0"},
+			},
+			Expected: map[string]interface{}{
+				"name": "base",
+				"image": map[string]interface{}{
+					"repository": "nginx",
+					"tag":        "2.0",
+				},
+				"list": []interface{}{"a", "b"},
+			},
+		},
+		{
+			Name: "replace lists and scalars",
+			Sample: map[string]interface{}{
+				"name": "overlay",
+				"list": []interface{}{"c"},
+			},
+			Expected: map[string]interface{}{
+				"name": "overlay",
+				"image": map[string]interface{}{
+					"repository": "nginx",
+					"tag":        "1.0",
+				},
+				"list": []interface{}{"c"},
+			},
+		},
+		{
+			Name: "replace map with scalar",
+			Sample: map[string]interface{}{
+				"image": "nginx:latest",
+			},
+			Expected: map[string]interface{}{
+				"name":  "base",
+				"image": "nginx:latest",
+				"list":  []interface{}{"a", "b"},
+			},
+		},
+	}
+	for i, test := range tests {
+		t.Logf("Test case %d: %s", i, test.Name)
+		merged := MergeMaps(base, test.Sample.(map[string]interface{}))
+		assert.Equal(t, test.Expected, merged, "should deep merge the maps")
+	}
+	assert.Equal(t, "1.0", base["image"].(map[string]interface{})["tag"], "should not modify the original map")
+}
+
+func TestParseAPIResources(t *testing.T) {
+	tests := []TestCase{
+		{
+			Name: "kubectl api-resources output",
+			Sample: `NAME                              SHORTNAMES   APIVERSION                        NAMESPACED   KIND
+configmaps                        cm           v1                                true         ConfigMap
+namespaces                        ns           v1                                false        Namespace
+clusterissuers                                 cert-manager.io/v1                false        ClusterIssuer
+issuers                                        cert-manager.io/v1                true         Issuer
+`,
+			Expected: ReturnWithError{
+				Value: map[string]bool{
+					"ConfigMap":     true,
+					"Namespace":     false,
+					"ClusterIssuer": false,
+					"Issuer":        true,
+				},
+				Error: false,
+			},
+		},
+		{
+			Name: "missing columns",
+			Sample: `NAME   SHORTNAMES
+configmaps   cm
+`,
+			Expected: ReturnWithError{
+				Error: true,
+			},
+		},
+		{
+			Name: "malformed line",
+			Sample: `NAME         NAMESPACED   KIND
+configmaps   maybe        ConfigMap
+`,
+			Expected: ReturnWithError{
+				Error: true,
+			},
+		},
+		{
+			Name:   "empty file",
+			Sample: ``,
+			Expected: ReturnWithError{
+				Error: true,
+			},
+		},
+	}
+
+	for i, test := range tests {
+		t.Logf("Test case %d: %s", i, test.Name)
+
+		expected := test.Expected.(ReturnWithError)
+		val, err := ParseAPIResources(strings.NewReader(test.Sample.(string)))
+
+		if expected.Error {
+			assert.Error(t, err, "should return an error")
+			assert.Nil(t, val, "return should be nil on error")
+		} else {
+			assert.Nil(t, err, "should not return error")
+			assert.Equal(t, expected.Value.(map[string]bool), val, "parsed resources should match expected")
+		}
+	}
+}
+
+func TestDedupResources(t *testing.T) {
+	configMap := func(data string) map[string]interface{} {
+		return map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata": map[interface{}]interface{}{
+				"name":      "config",
+				"namespace": "ns",
+			},
+			"data": map[interface{}]interface{}{"key": data},
+		}
+	}
+	namespace := func(labels map[string]string) map[string]interface{} {
+		return CreateNamespace("ns", nil, labels)
+	}
+	noIdentity := map[string]interface{}{"hello": "world"}
+
+	tests := []TestCase{
+		{
+			Name: "identical resources",
+			Sample: []Resource{
+				{Manifest: configMap("a"), Source: "app1"},
+				{Manifest: noIdentity, Source: "app1"},
+				{Manifest: configMap("a"), Source: "app2"},
+				{Manifest: noIdentity, Source: "app2"},
+			},
+			Expected: ReturnWithError{
+				Value: []Resource{
+					{Manifest: configMap("a"), Source: "app1"},
+					{Manifest: noIdentity, Source: "app1"},
+				},
+				Error: false,
+			},
+		},
+		{
+			Name: "conflicting resources",
+			Sample: []Resource{
+				{Manifest: configMap("a"), Source: "app1"},
+				{Manifest: configMap("b"), Source: "app2"},
+			},
+			Expected: ReturnWithError{
+				Value: &ConflictError{
+					Conflicts: []Conflict{
+						{
+							Identity: "v1/ConfigMap ns/config",
+							Sources:  []string{"app1", "app2"},
+							Reason:   "contents differ",
+						},
+					},
+				},
+				Error: true,
+			},
+		},
+		{
+			Name: "namespaces with different labels",
+			Sample: []Resource{
+				{Manifest: namespace(map[string]string{"team": "a"}), Source: "app1"},
+				{Manifest: configMap("a"), Source: "app1"},
+				{Manifest: namespace(map[string]string{"istio-injection": "enabled"}), Source: "app2"},
+			},
+			Expected: ReturnWithError{
+				Value: []Resource{
+					{
+						Manifest: map[string]interface{}{
+							"apiVersion": "v1",
+							"kind":       "Namespace",
+							"metadata": map[string]interface{}{
+								"annotations": map[interface{}]interface{}{"fluxcd.io/ignore": "sync_only"},
+								"labels":      map[interface{}]interface{}{"name": "ns", "team": "a", "istio-injection": "enabled"},
+								"name":        "ns",
+							},
+						},
+						Source: "app1",
+					},
+					{Manifest: configMap("a"), Source: "app1"},
+				},
+				Error: false,
+			},
+		},
+		{
+			Name: "namespaces with conflicting labels",
+			Sample: []Resource{
+				{Manifest: namespace(map[string]string{"team": "a"}), Source: "app1"},
+				{Manifest: namespace(map[string]string{"team": "b"}), Source: "app2"},
+			},
+			Expected: ReturnWithError{
+				Value: &ConflictError{
+					Conflicts: []Conflict{
+						{
+							Identity: "v1/Namespace /ns",
+							Sources:  []string{"app1", "app2"},
+							Reason:   `labels "team" differs: a != b`,
+						},
+					},
+				},
+				Error: true,
+			},
+		},
+	}
+
+	for i, test := range tests {
+		t.Logf("Test case %d: %s", i, test.Name)
+
+		expected := test.Expected.(ReturnWithError)
+		val, err := DedupResources(test.Sample.([]Resource))
+
+		if expected.Error {
+			assert.Equal(t, expected.Value, err, "should report the conflicts")
+			assert.Nil(t, val, "return should be nil on error")
+		} else {
+			assert.Nil(t, err, "should not return error")
+			assert.Equal(t, expected.Value.([]Resource), val, "should have deduped list")
+		}
+	}
+}
+
+func TestToJSONCompatible(t *testing.T) {
+	sample := map[string]interface{}{
+		"metadata": map[interface{}]interface{}{
+			"name":   "test",
+			"labels": map[interface{}]interface{}{"app": "test"},
+		},
+		"ports": []interface{}{
+			map[interface{}]interface{}{"port": 80},
+		},
+	}
+	expected := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name":   "test",
+			"labels": map[string]interface{}{"app": "test"},
+		},
+		"ports": []interface{}{
+			map[string]interface{}{"port": 80},
+		},
+	}
+	assert.Equal(t, expected, ToJSONCompatible(sample), "should convert every map to string keys")
+}
+
+func TestSortResources(t *testing.T) {
+	resource := func(kind, namespace, name string) Resource {
+		metadata := map[interface{}]interface{}{"name": name}
+		if namespace != "" {
+			metadata["namespace"] = namespace
+		}
+		return Resource{Manifest: map[string]interface{}{"kind": kind, "metadata": metadata}}
+	}
+	resources := []Resource{
+		resource("Deployment", "b", "web"),
+		resource("Certificate", "a", "tls"),
+		resource("Service", "b", "web"),
+		resource("Deployment", "a", "web"),
+		resource("Namespace", "", "b"),
+		resource("Alertmanager", "a", "main"),
+		resource("ConfigMap", "a", "config"),
+		resource("Namespace", "", "a"),
+		resource("Deployment", "a", "api"),
+	}
+	expected := []Resource{
+		resource("Namespace", "", "a"),
+		resource("Namespace", "", "b"),
+		resource("ConfigMap", "a", "config"),
+		resource("Service", "b", "web"),
+		resource("Deployment", "a", "api"),
+		resource("Deployment", "a", "web"),
+		resource("Deployment", "b", "web"),
+		resource("Alertmanager", "a", "main"),
+		resource("Certificate", "a", "tls"),
+	}
+	SortResources(resources, []string{"Namespace", "ConfigMap", "Service", "Deployment"})
+	assert.Equal(t, expected, resources, "should sort by kind order, then namespace and name")
+}